@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"test-task/internal/config"
+	"test-task/internal/services"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: balancer [command] [flags]
+
+commands:
+  validate        check the config and exit
+  print-config    print the config with defaults and overrides applied
+  check-backends  probe every configured server once and print a report
+
+without a command the balancer is started
+
+flags:
+`
+
+// commands write their report to w and return the exit code.
+var commands = map[string]func(cfg *config.Config, w io.Writer) int{
+	"validate":       validate,
+	"print-config":   printConfig,
+	"check-backends": checkBackends,
+}
+
+type options struct {
+	command string // empty when the balancer should run
+	file    string
+	// overrides win over the environment, which wins over the file
+	overrides []string
+}
+
+func parseArgs(args []string) (options, error) {
+	var opts options
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		opts.command, args = args[0], args[1:]
+		if _, ok := commands[opts.command]; !ok {
+			return opts, fmt.Errorf("unknown command %q, see -h", opts.command)
+		}
+	}
+
+	flags := flag.NewFlagSet("balancer", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.file, "config", config.Path(), "config file")
+	flags.Func("set", "override a config key, e.g. -set sticky_sessions.enabled=true (repeatable)", func(value string) error {
+		if !strings.Contains(value, "=") {
+			return errors.New("expected key=value")
+		}
+		opts.overrides = append(opts.overrides, value)
+		return nil
+	})
+	flags.Func("servers", "servers as address[=weight],..., e.g. http://a:8080=3,http://b:8080", func(value string) error {
+		opts.overrides = append(opts.overrides, "servers="+value)
+		return nil
+	})
+	err := flags.Parse(args)
+	return opts, err
+}
+
+func validate(cfg *config.Config, w io.Writer) int {
+	fmt.Fprintf(w, "config is valid: %d servers, %d pools, %d routes, %d listeners\n",
+		len(cfg.Servers), len(cfg.Pools), len(cfg.Routes), len(cfg.Listeners))
+	return 0
+}
+
+func printConfig(cfg *config.Config, w io.Writer) int {
+	if err := config.Dump(w, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print config: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type backendReport struct {
+	pool     string
+	server   *services.ServerInfo
+	duration time.Duration
+	err      error
+}
+
+// checkBackends probes the configured servers, discovered ones are not
+// known without running the discovery.
+func checkBackends(cfg *config.Config, out io.Writer) int {
+
+	var prober services.Prober = services.NewHTTPProber(cfg.HealthCheckTimeout)
+	if cfg.Mode == config.TCP {
+		prober = services.NewTCPProber(cfg.HealthCheckTimeout)
+	}
+
+	var reports []*backendReport
+	for _, s := range cfg.Servers {
+		server := services.NewServerInfo(s.Address, s.HealthPath)
+		reports = append(reports, &backendReport{pool: config.DefaultPool, server: server})
+	}
+	for _, p := range cfg.Pools {
+		for _, s := range p.Servers {
+			server := services.NewServerInfo(s.Address, s.HealthPath)
+			reports = append(reports, &backendReport{pool: p.Name, server: server})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range reports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			r.err = prober.Probe(r.server)
+			r.duration = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POOL\tSERVER\tSTATUS\tTIME\tERROR")
+	for _, r := range reports {
+		status, errText := "ok", ""
+		if r.err != nil {
+			status, errText = "failed", r.err.Error()
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.pool, r.server.HealthCheckAddress(), status, r.duration.Round(time.Millisecond), errText)
+	}
+	_ = w.Flush()
+
+	if cfg.Discovery.Provider != "" {
+		fmt.Fprintf(out, "\nservers from %s discovery are not checked\n", cfg.Discovery.Provider)
+	}
+	if failed > 0 {
+		fmt.Fprintf(out, "\n%d of %d servers failed\n", failed, len(reports))
+		return 1
+	}
+	return 0
+}
@@ -2,19 +2,48 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"test-task/internal/app"
+	"test-task/internal/config"
 )
 
 func main() {
 
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(opts.file, opts.overrides...)
+	if opts.command != "" {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", opts.file, err)
+			os.Exit(1)
+		}
+		os.Exit(commands[opts.command](cfg, os.Stdout))
+	}
+	if err != nil {
+		slog.Error("failed to load config", "file", opts.file, "error", err)
+		os.Exit(1)
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	// SIGUSR2 hands the listening sockets over to a new binary
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, syscall.SIGUSR2)
 
-	myapp, err := app.New()
+	myapp, err := app.New(cfg)
 	if err != nil {
 		slog.Error("failed to initialize app", "error", err)
 		os.Exit(1)
@@ -22,8 +51,23 @@ func main() {
 
 	go myapp.Run()
 
-	<-stop
-	slog.Info("received termination signal")
+	for running := true; running; {
+		select {
+		case <-stop:
+			slog.Info("received termination signal")
+			running = false
+		case <-upgrade:
+			slog.Info("received upgrade signal")
+			ctx, cancel := context.WithTimeout(context.Background(), myapp.Config.UpgradeTimeout)
+			err := myapp.Upgrade(ctx)
+			cancel()
+			if err != nil {
+				slog.Error("upgrade failed", "error", err)
+				continue
+			}
+			running = false
+		}
+	}
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), myapp.Config.ShutdownTimeout)
 	defer cancel()
@@ -2,89 +2,574 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	nethttp "net/http"
 	"os"
+	"slices"
+	"sync"
+	"test-task/internal/backendurl"
 	"test-task/internal/config"
 	"test-task/internal/services"
 	"test-task/internal/services/balancers"
+	"test-task/internal/services/discovery"
 	"test-task/internal/transport/http"
+	"test-task/internal/transport/proxyproto"
+	"test-task/internal/transport/tcp"
+	"time"
 )
 
+type server interface {
+	Serve(ln net.Listener) error
+	Shutdown(ctx context.Context) error
+}
+
+// listener is a server with the address it accepts connections on.
+type listener struct {
+	name     string
+	address  string
+	protocol config.Protocol
+	server   server
+	tls      *tls.Config // set for https
+}
+
 type App struct {
-	Config        *config.Config
-	server        *nethttp.Server
-	checker       *services.HealthChecker
-	checkerCancel context.CancelFunc
+	Config       *config.Config
+	listeners    []listener
+	admin        *nethttp.Server
+	trustedCIDRs []*net.IPNet
+	pool         *services.Pool
+	discovery    services.Discovery
+	checkers     []*services.HealthChecker
+	webhooks     []*services.Webhook
+	cancel       context.CancelFunc
+
+	mu      sync.Mutex
+	sockets []socket
 }
 
-func New() (*App, error) {
+func New(cfg *config.Config) (*App, error) {
 
-	cfg, err := config.Get()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
 	slog.Info("current environment", "env", cfg.Env)
 
 	initLogger(cfg)
 
-	servers := make([]*services.ServerInfo, len(cfg.Servers))
-	for i, s := range cfg.Servers {
-		servers[i] = services.NewServerInfo(s.Address, s.HealthPath)
+	events := services.NewEventBus()
+	events.Subscribe(services.LogEvent)
+	var webhooks []*services.Webhook
+	for _, w := range cfg.Webhooks {
+		types := make([]services.EventType, len(w.Events))
+		for i, e := range w.Events {
+			types[i] = services.EventType(e)
+		}
+		webhook, err := services.NewWebhook(services.WebhookConfig{
+			URL:        w.URL,
+			Events:     types,
+			Timeout:    w.Timeout,
+			MaxRetries: w.MaxRetries,
+			RetryDelay: w.RetryDelay})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook: %w", err)
+		}
+		events.Subscribe(webhook.Notify)
+		webhooks = append(webhooks, webhook)
 	}
 
-	var balancer http.Balancer
-	switch cfg.Algorithm {
-	case config.RoundRobin:
-		balancer = balancers.NewRoundRobinBalancer(servers)
-	case config.LeastConnections:
-		balancer = balancers.NewLeastConnectionsBalancer(servers)
+	// The servers of the default pool and of the named pools are built in one
+	// loop, owners holds the pool of each.
+	configured := slices.Clone(cfg.Servers)
+	owners := slices.Repeat([]string{config.DefaultPool}, len(cfg.Servers))
+	for _, p := range cfg.Pools {
+		configured = append(configured, p.Servers...)
+		owners = append(owners, slices.Repeat([]string{p.Name}, len(p.Servers))...)
+	}
+	servers := make([]*services.ServerInfo, 0, len(cfg.Servers))
+	poolServers := make(map[string][]*services.ServerInfo, len(cfg.Pools))
+	for i, s := range configured {
+		info := services.NewTargetServer(services.Target{
+			Address:             s.Address,
+			HealthPath:          s.HealthPath,
+			Weight:              s.Weight,
+			Labels:              serverLabels(s.Labels, s.Zone),
+			Priority:            s.Priority,
+			Backup:              s.Backup,
+			HealthCheckInterval: s.HealthCheckInterval,
+		}, events)
+		if owners[i] == config.DefaultPool {
+			servers = append(servers, info)
+		} else {
+			poolServers[owners[i]] = append(poolServers[owners[i]], info)
+		}
+	}
+
+	balancer, err := newBalancer(cfg, cfg.Algorithm, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	pools := map[string]balancers.Balancer{config.DefaultPool: balancer}
+	for _, p := range cfg.Pools {
+		algorithm := p.Algorithm
+		if algorithm == "" {
+			algorithm = cfg.Algorithm
+		}
+		pools[p.Name], err = newBalancer(cfg, algorithm, poolServers[p.Name])
+		if err != nil {
+			return nil, fmt.Errorf("pool %s: %w", p.Name, err)
+		}
+	}
+
+	var cache *http.Cache
+	if cfg.Cache.Enabled {
+		cache = http.NewCache(cfg.Cache.MaxBytes, cfg.Cache.MaxEntryBytes)
+	}
+
+	var mirrors []*http.Mirror
+	var splits []*http.Split
+	routes := make([]http.Route, len(cfg.Routes))
+	for i, r := range cfg.Routes {
+		var mirror *http.Mirror
+		if r.Mirror != nil {
+			mirror, err = http.NewMirror(http.MirrorConfig{
+				Route:                 r.Path,
+				Pool:                  r.Mirror.Pool,
+				Balancer:              pools[r.Mirror.Pool],
+				Percent:               r.Mirror.Percent,
+				MaxBodyBytes:          r.Mirror.MaxBodyBytes,
+				RouteMaxBodyBytes:     r.MaxBodyBytes,
+				Timeout:               r.Mirror.Timeout,
+				DialTimeout:           cfg.DialTimeout,
+				KeepAlive:             cfg.KeepAlive,
+				IdleConnTimeout:       cfg.IdleConnTimeout,
+				ResponseHeaderTimeout: cfg.ResponseHeaderTimeout})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create mirror for route %s: %w", r.Path, err)
+			}
+			mirrors = append(mirrors, mirror)
+		}
+
+		var split *http.Split
+		if r.Split != nil {
+			backends := make([]http.SplitBackend, len(r.Split.Pools))
+			for j, b := range r.Split.Pools {
+				backends[j] = http.SplitBackend{Pool: b.Pool, Balancer: pools[b.Pool], Weight: b.Weight}
+			}
+			split, err = http.NewSplit(http.SplitConfig{
+				Route:    r.Path,
+				Backends: backends,
+				Header:   r.Split.Header,
+				Cookie:   r.Split.Cookie})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create split for route %s: %w", r.Path, err)
+			}
+			splits = append(splits, split)
+		}
+
+		routes[i] = http.Route{
+			Path:            r.Path,
+			Coalesce:        r.Coalesce,
+			RequestHeaders:  http.HeaderRules(r.RequestHeaders),
+			ResponseHeaders: http.HeaderRules(r.ResponseHeaders),
+			MaxBodyBytes:    r.MaxBodyBytes,
+			UpstreamTimeout: r.UpstreamTimeout,
+			Access: http.Access{
+				Allow:     r.Access.Allow,
+				Deny:      r.Access.Deny,
+				BasicAuth: http.BasicAuth(r.Access.BasicAuth),
+				JWT:       http.JWTAuth(r.Access.JWT)},
+			Mirror: mirror,
+			Split:  split,
+		}
+	}
+
+	var prober services.Prober
+	var checkAddress func(address string) error
+	switch cfg.Mode {
+	case config.HTTP:
+		prober = services.NewHTTPProber(cfg.HealthCheckTimeout)
+		checkAddress = func(address string) error {
+			_, err := backendurl.Parse(address)
+			return err
+		}
+	case config.TCP:
+		prober = services.NewTCPProber(cfg.HealthCheckTimeout)
+		checkAddress = func(address string) error {
+			_, _, err := net.SplitHostPort(address)
+			return err
+		}
 	default:
-		return nil, errors.New("invalid algorithm")
+		return nil, errors.New("invalid mode")
 	}
 
-	checker := services.NewHealthChecker(servers, cfg.HealthCheckInterval, cfg.HealthCheckTimeout)
-	server, err := http.NewServer(http.Config{
-		Port:                cfg.Port,
-		DialTimeout:         cfg.DialTimeout,
-		KeepAlive:           cfg.KeepAlive,
-		MaxIdleConns:        cfg.MaxIdleConns,
-		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
-		IdleConnTimeout:     cfg.IdleConnTimeout},
-		balancer)
+	listeners := make([]listener, len(cfg.Listeners))
+	for i, l := range cfg.Listeners {
+		listeners[i] = listener{name: l.Name, address: l.Address, protocol: l.Protocol}
+
+		switch l.Protocol {
+		case config.HTTPListener, config.HTTPSListener:
+			srv, err := http.NewServer(http.Config{
+				Name:                  l.Name,
+				Address:               l.Address,
+				DialTimeout:           cfg.DialTimeout,
+				KeepAlive:             cfg.KeepAlive,
+				MaxIdleConns:          cfg.MaxIdleConns,
+				MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+				IdleConnTimeout:       cfg.IdleConnTimeout,
+				ReadHeaderTimeout:     l.ReadHeaderTimeout,
+				ReadTimeout:           l.ReadTimeout,
+				WriteTimeout:          l.WriteTimeout,
+				IdleTimeout:           l.IdleTimeout,
+				MaxHeaderBytes:        l.MaxHeaderBytes,
+				ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+				TrustedProxies:        cfg.TrustedProxies,
+				StickySessions: http.StickySessions{
+					Enabled:    cfg.StickySessions.Enabled,
+					CookieName: cfg.StickySessions.CookieName,
+					TTL:        cfg.StickySessions.TTL,
+					Path:       cfg.StickySessions.Path,
+					SameSite:   sameSite(cfg.StickySessions.SameSite),
+					Secure:     cfg.StickySessions.Secure,
+					Secret:     cfg.StickySessions.Secret},
+				Cache:       cache,
+				Routes:      listenerRoutes(routes, l.Routes),
+				HiddenPaths: hiddenPaths(routes, l.Routes),
+				Compression: http.Compression{
+					Enabled:      cfg.Compression.Enabled,
+					MinSize:      cfg.Compression.MinSize,
+					ContentTypes: cfg.Compression.ContentTypes},
+				TLS: http.TLS(l.TLS)},
+				pools[l.Pool])
+			if err != nil {
+				return nil, fmt.Errorf("failed to create listener %s: %w", l.Name, err)
+			}
+			listeners[i].server = srv
+			listeners[i].tls = srv.TLSConfig
+		case config.TCPListener:
+			srv, err := tcp.NewServer(tcp.Config{
+				Address:           l.Address,
+				ConnectTimeout:    cfg.DialTimeout,
+				IdleTimeout:       l.IdleTimeout,
+				SendProxyProtocol: cfg.ProxyProtocol.SendToBackends},
+				pools[l.Pool])
+			if err != nil {
+				return nil, fmt.Errorf("failed to create listener %s: %w", l.Name, err)
+			}
+			listeners[i].server = srv
+		default:
+			return nil, errors.New("invalid listener protocol")
+		}
+	}
+
+	trustedCIDRs, err := proxyproto.ParseCIDRs(cfg.ProxyProtocol.TrustedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy protocol config: %w", err)
+	}
+
+	var admin *nethttp.Server
+	if cfg.Admin.Port != 0 {
+		adminPools := []http.AdminPool{{Name: config.DefaultPool, Balancer: balancer}}
+		for _, p := range cfg.Pools {
+			adminPools = append(adminPools, http.AdminPool{Name: p.Name, Balancer: pools[p.Name]})
+		}
+		admin, err = http.NewAdminServer(http.AdminConfig{
+			Port:    cfg.Admin.Port,
+			Cache:   cache,
+			Mirrors: mirrors,
+			Splits:  splits,
+			Pools:   adminPools})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create admin server: %w", err)
+		}
+	}
+
+	healthCheck := services.HealthCheckConfig{
+		Interval:          cfg.HealthCheckInterval,
+		UnhealthyInterval: cfg.HealthCheckUnhealthyInterval,
+		Jitter:            float64(cfg.HealthCheckJitterPercent) / 100,
+		MaxConcurrent:     cfg.HealthCheckMaxConcurrent,
+	}
+	checker := services.NewHealthChecker(servers, prober, healthCheck)
+	checkers := []*services.HealthChecker{checker}
+	for _, p := range cfg.Pools {
+		checkers = append(checkers, services.NewHealthChecker(poolServers[p.Name], prober, healthCheck))
+	}
+
+	pool := services.NewPool(servers)
+	pool.SetEvents(events)
+	pool.SetAddressCheck(checkAddress)
+	pool.OnChange(balancer.SetServers)
+	pool.OnChange(checker.SetServers)
+
+	var d services.Discovery
+	switch cfg.Discovery.Provider {
+	case "":
+	case config.DNSDiscovery:
+		d, err = discovery.NewDNS(discovery.DNSConfig{
+			Name:            cfg.Discovery.DNS.Name,
+			Type:            discovery.RecordType(cfg.Discovery.DNS.Type),
+			Port:            cfg.Discovery.DNS.Port,
+			Scheme:          cfg.Discovery.DNS.Scheme,
+			HealthPath:      cfg.Discovery.DNS.HealthPath,
+			Server:          cfg.Discovery.DNS.Server,
+			RefreshInterval: cfg.Discovery.RefreshInterval})
+	case config.FileDiscovery:
+		d, err = discovery.NewFile(discovery.FileConfig{
+			Path:       cfg.Discovery.File.Path,
+			HealthPath: cfg.Discovery.File.HealthPath,
+			Debounce:   cfg.Discovery.File.Debounce})
+	case config.ConsulDiscovery:
+		d, err = discovery.NewConsul(discovery.ConsulConfig{
+			Address:       cfg.Discovery.Consul.Address,
+			Service:       cfg.Discovery.Consul.Service,
+			Tag:           cfg.Discovery.Consul.Tag,
+			Datacenter:    cfg.Discovery.Consul.Datacenter,
+			Token:         cfg.Discovery.Consul.Token,
+			Scheme:        cfg.Discovery.Consul.Scheme,
+			HealthPath:    cfg.Discovery.Consul.HealthPath,
+			WaitTime:      cfg.Discovery.Consul.WaitTime,
+			RetryInterval: cfg.Discovery.RefreshInterval})
+	case config.EtcdDiscovery:
+		d, err = discovery.NewEtcd(discovery.EtcdConfig{
+			Endpoint:      cfg.Discovery.Etcd.Endpoint,
+			Prefix:        cfg.Discovery.Etcd.Prefix,
+			HealthPath:    cfg.Discovery.Etcd.HealthPath,
+			RetryInterval: cfg.Discovery.RefreshInterval})
+	default:
+		return nil, errors.New("invalid discovery provider")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create server: %w", err)
+		return nil, fmt.Errorf("failed to create discovery: %w", err)
 	}
 
-	return &App{Config: cfg, server: server, checker: checker}, nil
+	return &App{
+		Config:       cfg,
+		listeners:    listeners,
+		admin:        admin,
+		trustedCIDRs: trustedCIDRs,
+		pool:         pool,
+		discovery:    d,
+		checkers:     checkers,
+		webhooks:     webhooks,
+	}, nil
 }
 
+// initialDiscoveryTimeout bounds the wait for the first discovery sync at
+// startup, the servers found later are added as they come.
+const initialDiscoveryTimeout = 10 * time.Second
+
 func (a *App) Run() {
 
 	ctx, cancel := context.WithCancel(context.Background())
-	a.checkerCancel = cancel
-	go a.checker.Run(ctx)
+	a.cancel = cancel
+	for _, webhook := range a.webhooks {
+		go webhook.Run(ctx)
+	}
+	// the servers of the first sync are part of the initial health check
+	if a.discovery != nil {
+		go a.discovery.Run(ctx, a.pool)
+		select {
+		case <-a.pool.Synced():
+		case <-time.After(initialDiscoveryTimeout):
+			slog.Warn("no servers discovered yet, starting without them", "timeout", initialDiscoveryTimeout)
+		}
+	}
+	for _, checker := range a.checkers {
+		go checker.Run(ctx)
+	}
+	// servers start unhealthy, don't take traffic before they are probed
+	for _, checker := range a.checkers {
+		<-checker.Ready()
+	}
 
-	if err := a.server.ListenAndServe(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+	inherited, err := inheritedListeners()
+	if err != nil {
 		slog.Error("failed to start server", "error", err)
 		os.Exit(1)
 	}
+
+	if a.admin != nil {
+		ln, err := a.listen(inherited, a.admin.Addr)
+		if err != nil {
+			slog.Error("failed to start admin server", "error", err)
+		} else {
+			go a.runAdmin(ln)
+		}
+	}
+
+	// bind every address before serving, so a busy port fails the start
+	lns := make([]net.Listener, len(a.listeners))
+	for i, l := range a.listeners {
+		ln, err := a.listen(inherited, l.address)
+		if err != nil {
+			slog.Error("failed to start server", "listener", l.name, "error", err)
+			os.Exit(1)
+		}
+
+		// the PROXY header comes before the TLS handshake
+		if a.Config.ProxyProtocol.Accept {
+			ln = proxyproto.NewListener(ln, a.trustedCIDRs, a.Config.ProxyProtocol.HeaderTimeout)
+		}
+		if l.tls != nil {
+			ln = tls.NewListener(ln, l.tls)
+		}
+		lns[i] = ln
+	}
+
+	// addresses removed from the config since the upgrade
+	for address, ln := range inherited {
+		slog.Info("closing inherited listener", "address", address)
+		_ = ln.Close()
+	}
+
+	var wg sync.WaitGroup
+	for i, l := range a.listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.Info("listener is running", "listener", l.name, "address", l.address, "protocol", l.protocol)
+
+			err := l.server.Serve(lns[i])
+			if err != nil && !errors.Is(err, nethttp.ErrServerClosed) && !errors.Is(err, tcp.ErrServerClosed) {
+				slog.Error("failed to start server", "listener", l.name, "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	notifyReady()
+	wg.Wait()
+}
+
+func (a *App) runAdmin(ln net.Listener) {
+	slog.Info("admin server is running", "address", a.admin.Addr)
+	if err := a.admin.Serve(ln); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+		slog.Error("failed to start admin server", "error", err)
+	}
 }
 
 func (a *App) Stop(ctx context.Context) {
 
 	slog.Info("shutting down gracefully...")
 
-	if err := a.server.Shutdown(ctx); err != nil {
-		slog.Error("failed to gracefully shutdown server", "error", err)
-	} else {
-		slog.Info("HTTP server gracefully stopped")
+	var wg sync.WaitGroup
+	for _, l := range a.listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.server.Shutdown(ctx); err != nil {
+				slog.Error("failed to gracefully shutdown server", "listener", l.name, "error", err)
+			} else {
+				slog.Info("server gracefully stopped", "listener", l.name)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if a.admin != nil {
+		if err := a.admin.Shutdown(ctx); err != nil {
+			slog.Error("failed to gracefully shutdown admin server", "error", err)
+		}
+	}
+
+	a.cancel()
+	for _, checker := range a.checkers {
+		checker.WaitForStop()
+	}
+	if a.discovery != nil {
+		a.discovery.WaitForStop()
+	}
+	for _, webhook := range a.webhooks {
+		webhook.WaitForStop()
+	}
+}
+
+func newBalancer(cfg *config.Config, algorithm config.Algorithm, servers []*services.ServerInfo) (balancers.Balancer, error) {
+
+	var factory balancers.Factory
+	switch algorithm {
+	case config.RoundRobin:
+		factory = balancers.RoundRobin
+	case config.LeastConnections:
+		factory = balancers.LeastConnections
+	default:
+		return nil, errors.New("invalid algorithm")
 	}
 
-	a.checkerCancel()
-	a.checker.WaitForStop()
+	if cfg.Locality.Zone != "" {
+		inner := factory
+		minHealthy := float64(cfg.Locality.MinHealthyPercent) / 100
+		factory = func(servers []*services.ServerInfo) balancers.Balancer {
+			return balancers.NewLocalityBalancer(servers, cfg.Locality.Zone, minHealthy, inner)
+		}
+	}
+
+	failover := float64(cfg.FailoverUnhealthyPercent) / 100
+	var balancer balancers.Balancer = balancers.NewPriorityBalancer(servers, failover, factory)
+
+	if cfg.PanicThresholdPercent > 0 {
+		balancer = balancers.NewPanicBalancer(balancer, float64(cfg.PanicThresholdPercent)/100)
+	}
+	return balancer, nil
+}
+
+// listenerRoutes picks the routes a listener serves, all of them when paths
+// is empty.
+func listenerRoutes(routes []http.Route, paths []string) []http.Route {
+	if len(paths) == 0 {
+		return routes
+	}
+
+	var selected []http.Route
+	for _, route := range routes {
+		if slices.Contains(paths, route.Path) {
+			selected = append(selected, route)
+		}
+	}
+	return selected
+}
+
+// hiddenPaths are the paths of routes the listener doesn't serve. Without
+// them such requests would reach the listener's pool through "/", skipping
+// the route's access rules and limits.
+func hiddenPaths(routes []http.Route, paths []string) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	var hidden []string
+	for _, route := range routes {
+		if !slices.Contains(paths, route.Path) {
+			hidden = append(hidden, route.Path)
+		}
+	}
+	return hidden
+}
+
+// serverLabels adds the zone to the configured labels.
+func serverLabels(labels map[string]string, zone string) map[string]string {
+	if zone == "" {
+		return labels
+	}
+
+	merged := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		merged[k] = v
+	}
+	merged[services.ZoneLabel] = zone
+	return merged
+}
+
+func sameSite(value string) nethttp.SameSite {
+	switch value {
+	case "strict":
+		return nethttp.SameSiteStrictMode
+	case "none":
+		return nethttp.SameSiteNoneMode
+	default:
+		return nethttp.SameSiteLaxMode
+	}
 }
 
 func initLogger(cfg *config.Config) {
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"test-task/internal/config"
+	"test-task/internal/services"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+health_check_interval: 60s
+health_check_timeout: 10s
+dial_timeout: 30s
+keep_alive: 30s
+max_idle_conns: 100
+max_idle_conns_per_host: 10
+idle_conn_timeout: 90s
+shutdown_timeout: 10s
+algorithm: round-robin
+`
+
+func newTestApp(t *testing.T, yaml string) *App {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testConfig+yaml), 0o600))
+	cfg, err := config.Load(file)
+	require.NoError(t, err)
+
+	a, err := New(cfg)
+	require.NoError(t, err)
+	return a
+}
+
+func (a *App) handler(t *testing.T, name string) nethttp.Handler {
+	for _, l := range a.listeners {
+		if l.name == name {
+			return l.server.(*nethttp.Server).Handler
+		}
+	}
+	t.Fatalf("no listener %s", name)
+	return nil
+}
+
+func TestNew_ListenerHidesOtherRoutes(t *testing.T) {
+	a := newTestApp(t, `
+servers: [{address: "http://127.0.0.1:1", health_path: /health}]
+routes:
+  - path: /admin/
+    access: {deny: [0.0.0.0/0]}
+  - path: /public/
+listeners:
+  - {name: main, address: ":18090"}
+  - {name: public, address: ":18091", routes: [/public/]}
+`)
+
+	get := func(listener, path string) int {
+		rec := httptest.NewRecorder()
+		a.handler(t, listener).ServeHTTP(rec, httptest.NewRequest(nethttp.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, nethttp.StatusForbidden, get("main", "/admin/users"))
+	assert.Equal(t, nethttp.StatusNotFound, get("public", "/admin/users"))
+	assert.Equal(t, nethttp.StatusNotFound, get("public", "/admin/"))
+	// The backend is down, but the requests reach the pool.
+	assert.NotEqual(t, nethttp.StatusNotFound, get("public", "/public/a"))
+	assert.NotEqual(t, nethttp.StatusNotFound, get("public", "/other"))
+}
+
+func TestNew_PoolChecksAddressesByMode(t *testing.T) {
+	targets := []services.Target{
+		{Address: "http://127.0.0.1:2", HealthPath: "/health"},
+		{Address: "127.0.0.1:3", HealthPath: "/health"},
+	}
+
+	a := newTestApp(t, `
+port: 18092
+servers: [{address: "http://127.0.0.1:1", health_path: /health}]
+`)
+	a.pool.Update(targets)
+	require.Len(t, a.pool.Servers(), 1)
+	assert.Equal(t, "http://127.0.0.1:2", a.pool.Servers()[0].Address())
+
+	a = newTestApp(t, `
+port: 18092
+mode: tcp
+servers: [{address: "127.0.0.1:1"}]
+`)
+	a.pool.Update(targets)
+	require.Len(t, a.pool.Servers(), 1)
+	assert.Equal(t, "127.0.0.1:3", a.pool.Servers()[0].Address())
+}
+
+func TestNew_ConfiguredServers(t *testing.T) {
+	a := newTestApp(t, `
+port: 18093
+servers:
+  - {address: "http://127.0.0.1:1", health_path: /health, weight: 3, zone: eu-1, health_check_interval: 5s}
+  - {address: "http://127.0.0.1:2", health_path: /health, backup: true}
+pools:
+  - name: canary
+    servers: [{address: "http://127.0.0.1:3", health_path: /health}]
+`)
+
+	servers := a.pool.Servers()
+	require.Len(t, servers, 2)
+	assert.Equal(t, 3, servers[0].Weight())
+	assert.Equal(t, "eu-1", servers[0].Labels()[services.ZoneLabel])
+	assert.Equal(t, 5*time.Second, servers[0].HealthCheckInterval())
+	assert.True(t, servers[1].IsBackup())
+}
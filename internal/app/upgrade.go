@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// A process started by Upgrade finds its sockets in these variables. The
+// listening sockets are passed as fds 3 and up, in the order of
+// upgradeListenersEnv, and the new process writes to the fd in
+// upgradeReadyEnv once it serves on them.
+const (
+	upgradeListenersEnv = "UPGRADE_LISTENERS"
+	upgradeReadyEnv     = "UPGRADE_READY_FD"
+)
+
+// socket is a bound address that is handed over on upgrade.
+type socket struct {
+	address  string
+	listener *net.TCPListener
+}
+
+// inheritedListeners returns the sockets passed by the previous process, by
+// address.
+func inheritedListeners() (map[string]net.Listener, error) {
+	value, ok := os.LookupEnv(upgradeListenersEnv)
+	if !ok {
+		return nil, nil
+	}
+
+	listeners := make(map[string]net.Listener)
+	for i, address := range strings.Split(value, ",") {
+		f := os.NewFile(uintptr(3+i), address)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inherit listener %s: %w", address, err)
+		}
+		listeners[address] = ln
+	}
+	return listeners, nil
+}
+
+// listen takes over an inherited socket for the address, or binds a new one.
+func (a *App) listen(inherited map[string]net.Listener, address string) (net.Listener, error) {
+	ln, ok := inherited[address]
+	if ok {
+		delete(inherited, address)
+		slog.Info("inherited listener", "address", address)
+	} else {
+		var err error
+		ln, err = net.Listen("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tcpListener, ok := ln.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("unexpected listener type %T", ln)
+	}
+
+	a.mu.Lock()
+	a.sockets = append(a.sockets, socket{address: address, listener: tcpListener})
+	a.mu.Unlock()
+	return ln, nil
+}
+
+// notifyReady tells the process that started this one through Upgrade that it
+// can stop.
+func notifyReady() {
+	value, ok := os.LookupEnv(upgradeReadyEnv)
+	if !ok {
+		return
+	}
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Error("invalid upgrade ready fd", "value", value)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		slog.Error("failed to notify previous process", "error", err)
+	}
+}
+
+// Upgrade starts the current executable again with the listening sockets
+// and waits until it serves on them. On success both processes accept
+// connections, the caller should Stop this one to let it drain. On failure
+// the new process is killed and this one keeps running.
+func (a *App) Upgrade(ctx context.Context) error {
+
+	a.mu.Lock()
+	sockets := append([]socket(nil), a.sockets...)
+	a.mu.Unlock()
+	if len(sockets) == 0 {
+		return errors.New("not listening yet")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	files := make([]*os.File, 0, len(sockets)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	addresses := make([]string, len(sockets))
+	for i, s := range sockets {
+		f, err := s.listener.File()
+		if err != nil {
+			return fmt.Errorf("failed to get listener file %s: %w", s.address, err)
+		}
+		files = append(files, f)
+		addresses[i] = s.address
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+	defer ready.Close()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(upgradeEnv(),
+		upgradeListenersEnv+"="+strings.Join(addresses, ","),
+		upgradeReadyEnv+"="+strconv.Itoa(3+len(sockets)),
+	)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	// only the new process may hold the write end, so that its exit ends
+	// the read below
+	_ = readyWriter.Close()
+	files = files[:len(files)-1]
+
+	slog.Info("started new process, waiting for it to take over", "pid", cmd.Process.Pid)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		if errors.Is(err, io.EOF) {
+			err = errors.New("new process exited before it was ready")
+		}
+		result <- err
+	}()
+
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		go func() { _ = cmd.Wait() }()
+		return err
+	}
+
+	go func() { _ = cmd.Wait() }()
+	slog.Info("new process is ready", "pid", cmd.Process.Pid)
+	return nil
+}
+
+// upgradeEnv is the environment without the variables of a previous upgrade.
+func upgradeEnv() []string {
+	var env []string
+	for _, v := range os.Environ() {
+		if strings.HasPrefix(v, upgradeListenersEnv+"=") || strings.HasPrefix(v, upgradeReadyEnv+"=") {
+			continue
+		}
+		env = append(env, v)
+	}
+	return env
+}
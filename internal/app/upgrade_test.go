@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+)
+
+// helperEnv makes the test binary act as the process started by Upgrade:
+// "serve" takes over the inherited sockets and answers one connection,
+// "exit" fails before it is ready and "stall" never gets ready.
+const helperEnv = "GO_WANT_HELPER_PROCESS"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "serve":
+		os.Exit(serveInherited())
+	case "exit":
+		os.Exit(1)
+	case "stall":
+		time.Sleep(time.Minute)
+		os.Exit(1)
+	}
+}
+
+func serveInherited() int {
+	inherited, err := inheritedListeners()
+	if err != nil || len(inherited) != 1 {
+		fmt.Fprintln(os.Stderr, "unexpected inherited listeners:", inherited, err)
+		return 1
+	}
+
+	a := &App{}
+	for _, address := range slices.Collect(maps.Keys(inherited)) {
+		ln, err := a.listen(inherited, address)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		notifyReady()
+
+		_ = ln.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+		conn, err := ln.Accept()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		_, _ = io.WriteString(conn, "inherited "+address)
+		_ = conn.Close()
+	}
+	return 0
+}
+
+func readFrom(t *testing.T, address string) string {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Second)))
+
+	b, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestListen_RecordsSockets(t *testing.T) {
+	inherited, err := inheritedListeners()
+	require.NoError(t, err)
+	assert.Nil(t, inherited)
+
+	a := &App{}
+	ln, err := a.listen(inherited, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	require.Len(t, a.sockets, 1)
+	assert.Equal(t, "127.0.0.1:0", a.sockets[0].address)
+	assert.Equal(t, ln, net.Listener(a.sockets[0].listener))
+}
+
+func TestInheritedListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f, err := ln.(*net.TCPListener).File()
+	require.NoError(t, err)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), helperEnv+"=serve", upgradeListenersEnv+"=web")
+	cmd.ExtraFiles = []*os.File{f}
+	cmd.Stderr = os.Stderr
+	require.NoError(t, cmd.Start())
+
+	// only the child holds the socket now
+	_ = f.Close()
+	_ = ln.Close()
+
+	assert.Equal(t, "inherited web", readFrom(t, ln.Addr().String()))
+	require.NoError(t, cmd.Wait())
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Setenv(helperEnv, "serve")
+	a := &App{}
+	ln, err := a.listen(nil, "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, a.Upgrade(ctx))
+	_ = ln.Close()
+
+	assert.Equal(t, "inherited 127.0.0.1:0", readFrom(t, ln.Addr().String()))
+}
+
+func TestUpgrade_NewProcessExits(t *testing.T) {
+	t.Setenv(helperEnv, "exit")
+	a := &App{}
+	ln, err := a.listen(nil, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = a.Upgrade(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited before it was ready")
+}
+
+func TestUpgrade_Timeout(t *testing.T) {
+	t.Setenv(helperEnv, "stall")
+	a := &App{}
+	ln, err := a.listen(nil, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, a.Upgrade(ctx), context.DeadlineExceeded)
+}
+
+func TestUpgrade_NotListening(t *testing.T) {
+	assert.Error(t, (&App{}).Upgrade(context.Background()))
+}
@@ -0,0 +1,61 @@
+// Package backendurl parses and joins the addresses of http backends. It is
+// shared by the config validation and the server pool.
+package backendurl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Parse parses the address of an http backend:
+// scheme://host[:port][/base/path]. Requests are sent to the base path
+// joined with the request path.
+func Parse(address string) (*url.URL, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("host is required")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+	} else if strings.HasSuffix(u.Host, ":") {
+		return nil, errors.New("empty port")
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return nil, errors.New("only scheme, host, port and path are allowed")
+	}
+	return u, nil
+}
+
+// JoinPath appends the path of u to the base path of a backend with a
+// single slash between them, keeping the escaped form when either has one.
+func JoinPath(base, u *url.URL) (path, rawPath string) {
+	if base.RawPath == "" && u.RawPath == "" {
+		return joinPath(base.Path, u.Path), ""
+	}
+	return joinPath(base.Path, u.Path), joinPath(base.EscapedPath(), u.EscapedPath())
+}
+
+func joinPath(base, path string) string {
+	if base == "" {
+		return path
+	}
+	slashed := strings.HasSuffix(base, "/")
+	switch {
+	case slashed && strings.HasPrefix(path, "/"):
+		return base + path[1:]
+	case !slashed && !strings.HasPrefix(path, "/"):
+		return base + "/" + path
+	}
+	return base + path
+}
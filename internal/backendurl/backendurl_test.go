@@ -0,0 +1,59 @@
+package backendurl_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"test-task/internal/backendurl"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	u, err := backendurl.Parse("https://a.local:8443/api/")
+	require.NoError(t, err)
+	assert.Equal(t, "https", u.Scheme)
+	assert.Equal(t, "a.local:8443", u.Host)
+	assert.Equal(t, "/api/", u.Path)
+
+	for _, address := range []string{
+		"a:8080",
+		"ftp://a",
+		"http://",
+		"http://:8080",
+		"http://a:0",
+		"http://a:65536",
+		"http://a:",
+		"http://user:pass@a",
+		"http://a/?x=1",
+		"http://a/#top",
+		"http://a/%zz",
+	} {
+		_, err := backendurl.Parse(address)
+		assert.Error(t, err, address)
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		base, path    string
+		want, rawWant string
+	}{
+		{"http://a", "/users", "/users", ""},
+		{"http://a/", "/users", "/users", ""},
+		{"http://a/api", "/users", "/api/users", ""},
+		{"http://a/api/", "/users", "/api/users", ""},
+		{"http://a/api", "/", "/api/", ""},
+		{"http://a/api", "/files/a%2Fb", "/api/files/a/b", "/api/files/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		base, err := backendurl.Parse(tt.base)
+		require.NoError(t, err)
+		u, err := url.Parse(tt.path)
+		require.NoError(t, err)
+
+		path, rawPath := backendurl.JoinPath(base, u)
+		assert.Equal(t, tt.want, path, tt.base+tt.path)
+		assert.Equal(t, tt.rawWant, rawPath, tt.base+tt.path)
+	}
+}
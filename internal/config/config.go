@@ -1,10 +1,21 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"test-task/internal/backendurl"
 	"time"
 )
 
@@ -15,6 +26,24 @@ const (
 	Development Environment = "development"
 )
 
+type Mode string
+
+const (
+	HTTP Mode = "http"
+	TCP  Mode = "tcp"
+)
+
+type Protocol string
+
+const (
+	HTTPListener  Protocol = "http"
+	HTTPSListener Protocol = "https"
+	TCPListener   Protocol = "tcp"
+)
+
+// DefaultPool is how routes and listeners refer to the main servers.
+const DefaultPool = "default"
+
 type Algorithm string
 
 const (
@@ -23,60 +52,627 @@ const (
 )
 
 type server struct {
-	Address    string `mapstructure:"address" validate:"required"`
-	HealthPath string `mapstructure:"health_path" validate:"required"`
+	Address    string            `mapstructure:"address" validate:"required"`
+	HealthPath string            `mapstructure:"health_path"`
+	Weight     int               `mapstructure:"weight" validate:"gte=0"`
+	Labels     map[string]string `mapstructure:"labels"`
+	Zone       string            `mapstructure:"zone"`
+	Priority   int               `mapstructure:"priority" validate:"gte=0"`
+	Backup     bool              `mapstructure:"backup"`
+	// HealthCheckInterval overrides the global interval for this server.
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval" validate:"gte=0"`
+}
+
+// pool is a named group of servers that routes can send traffic to besides
+// the main servers.
+type pool struct {
+	Name      string    `mapstructure:"name" validate:"required,ne=default"`
+	Algorithm Algorithm `mapstructure:"algorithm" validate:"omitempty,oneof=round-robin least-connections"`
+	Servers   []server  `mapstructure:"servers" validate:"required,unique=Address,dive"`
+}
+
+// locality prefers servers in the balancer's own zone.
+type locality struct {
+	Zone              string `mapstructure:"zone"`
+	MinHealthyPercent int    `mapstructure:"min_healthy_percent" validate:"min=0,max=100"`
+}
+
+type proxyProtocol struct {
+	Accept         bool          `mapstructure:"accept"`
+	TrustedCIDRs   []string      `mapstructure:"trusted_cidrs" validate:"required_if=Accept true,dive,cidr"`
+	HeaderTimeout  time.Duration `mapstructure:"header_timeout" validate:"gt=0"`
+	SendToBackends bool          `mapstructure:"send_to_backends"`
+}
+
+type stickySessions struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	CookieName string        `mapstructure:"cookie_name" validate:"required_if=Enabled true"`
+	TTL        time.Duration `mapstructure:"ttl" validate:"gte=0"`
+	Path       string        `mapstructure:"path"`
+	SameSite   string        `mapstructure:"same_site" validate:"omitempty,oneof=lax strict none"`
+	Secure     bool          `mapstructure:"secure"`
+	Secret     string        `mapstructure:"secret" secret:"true"`
+}
+
+type cache struct {
+	Enabled       bool  `mapstructure:"enabled"`
+	MaxBytes      int64 `mapstructure:"max_bytes" validate:"gt=0"`
+	MaxEntryBytes int64 `mapstructure:"max_entry_bytes" validate:"gt=0"`
+}
+
+type compression struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	MinSize      int      `mapstructure:"min_size" validate:"gte=0"`
+	ContentTypes []string `mapstructure:"content_types"`
+}
+
+type headerRules struct {
+	Add    map[string]string `mapstructure:"add"`
+	Set    map[string]string `mapstructure:"set"`
+	Remove []string          `mapstructure:"remove"`
+}
+
+type access struct {
+	Allow     []string  `mapstructure:"allow" validate:"dive,cidr"`
+	Deny      []string  `mapstructure:"deny" validate:"dive,cidr"`
+	BasicAuth basicAuth `mapstructure:"basic_auth"`
+	JWT       jwtAuth   `mapstructure:"jwt"`
+}
+
+type basicAuth struct {
+	Realm string   `mapstructure:"realm"`
+	Users []string `mapstructure:"users" validate:"dive,contains=:" secret:"true"`
+}
+
+type jwtAuth struct {
+	JWKSFile string `mapstructure:"jwks_file" validate:"omitempty,file"`
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+}
+
+type mirror struct {
+	Pool         string        `mapstructure:"pool" validate:"required"`
+	Percent      float64       `mapstructure:"percent" validate:"gt=0,lte=100"`
+	MaxBodyBytes int64         `mapstructure:"max_body_bytes" validate:"gte=0"`
+	Timeout      time.Duration `mapstructure:"timeout" validate:"gte=0"`
+}
+
+type splitBackend struct {
+	Pool   string `mapstructure:"pool" validate:"required"`
+	Weight int    `mapstructure:"weight" validate:"gte=0"`
+}
+
+type split struct {
+	Pools  []splitBackend `mapstructure:"pools" validate:"required,min=1,unique=Pool,dive"`
+	Header string         `mapstructure:"header"`
+	Cookie string         `mapstructure:"cookie"`
+}
+
+type route struct {
+	Path            string        `mapstructure:"path" validate:"required,startswith=/"`
+	Coalesce        bool          `mapstructure:"coalesce"`
+	RequestHeaders  headerRules   `mapstructure:"request_headers"`
+	ResponseHeaders headerRules   `mapstructure:"response_headers"`
+	MaxBodyBytes    int64         `mapstructure:"max_body_bytes" validate:"gte=0"`
+	UpstreamTimeout time.Duration `mapstructure:"upstream_timeout" validate:"gte=0"`
+	Access          access        `mapstructure:"access"`
+	Mirror          *mirror       `mapstructure:"mirror" validate:"omitempty"`
+	Split           *split        `mapstructure:"split" validate:"omitempty"`
+}
+
+// webhook posts server events to on-call tooling.
+type webhook struct {
+	URL        string        `mapstructure:"url" validate:"required,http_url" secret:"true"`
+	Events     []string      `mapstructure:"events" validate:"dive,oneof=health_changed ejected added removed drained"`
+	Timeout    time.Duration `mapstructure:"timeout" validate:"gte=0"`
+	MaxRetries int           `mapstructure:"max_retries" validate:"gte=0"`
+	RetryDelay time.Duration `mapstructure:"retry_delay" validate:"gte=0"`
+}
+
+type tlsFiles struct {
+	CertFile string `mapstructure:"cert_file" validate:"omitempty,file"`
+	KeyFile  string `mapstructure:"key_file" validate:"omitempty,file"`
+}
+
+// listener accepts client traffic on its own address. Zero timeouts are
+// filled in from the global ones.
+type listener struct {
+	Name    string `mapstructure:"name" validate:"required"`
+	Address string `mapstructure:"address" validate:"required,hostname_port"`
+	// Protocol defaults to the mode.
+	Protocol Protocol `mapstructure:"protocol" validate:"omitempty,oneof=http https tcp"`
+	// Pool serves requests that no split route takes, or the connections of
+	// a tcp listener.
+	Pool string `mapstructure:"pool"`
+	// Routes lists the paths of the routes served, empty means all of them.
+	Routes            []string      `mapstructure:"routes" validate:"dive,startswith=/"`
+	TLS               tlsFiles      `mapstructure:"tls"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout" validate:"gte=0"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout" validate:"gte=0"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout" validate:"gte=0"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout" validate:"gte=0"`
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes" validate:"gte=0"`
+}
+
+type admin struct {
+	Port int `mapstructure:"port" validate:"min=0,max=65535"`
+}
+
+type DiscoveryProvider string
+
+const (
+	DNSDiscovery    DiscoveryProvider = "dns"
+	FileDiscovery   DiscoveryProvider = "file"
+	ConsulDiscovery DiscoveryProvider = "consul"
+	EtcdDiscovery   DiscoveryProvider = "etcd"
+)
+
+type dnsDiscovery struct {
+	Name       string `mapstructure:"name"`
+	Type       string `mapstructure:"type"`
+	Port       int    `mapstructure:"port"`
+	Scheme     string `mapstructure:"scheme"`
+	HealthPath string `mapstructure:"health_path"`
+	Server     string `mapstructure:"server"`
+}
+
+type fileDiscovery struct {
+	Path       string        `mapstructure:"path"`
+	HealthPath string        `mapstructure:"health_path"`
+	Debounce   time.Duration `mapstructure:"debounce"`
+}
+
+type consulDiscovery struct {
+	Address    string        `mapstructure:"address" secret:"url"`
+	Service    string        `mapstructure:"service"`
+	Tag        string        `mapstructure:"tag"`
+	Datacenter string        `mapstructure:"datacenter"`
+	Token      string        `mapstructure:"token" secret:"true"`
+	Scheme     string        `mapstructure:"scheme"`
+	HealthPath string        `mapstructure:"health_path"`
+	WaitTime   time.Duration `mapstructure:"wait_time"`
+}
+
+type etcdDiscovery struct {
+	Endpoint   string `mapstructure:"endpoint" secret:"url"`
+	Prefix     string `mapstructure:"prefix"`
+	HealthPath string `mapstructure:"health_path"`
+}
+
+type discovery struct {
+	Provider        DiscoveryProvider `mapstructure:"provider" validate:"omitempty,oneof=dns file consul etcd"`
+	RefreshInterval time.Duration     `mapstructure:"refresh_interval" validate:"gt=0"`
+	DNS             dnsDiscovery      `mapstructure:"dns"`
+	File            fileDiscovery     `mapstructure:"file"`
+	Consul          consulDiscovery   `mapstructure:"consul"`
+	Etcd            etcdDiscovery     `mapstructure:"etcd"`
 }
 
 type Config struct {
-	Env                 Environment   `mapstructure:"env"`
-	Port                int           `mapstructure:"port" validate:"required,min=1,max=65535"`
-	Servers             []server      `mapstructure:"servers" validate:"required,dive"`
-	Algorithm           Algorithm     `mapstructure:"algorithm" validate:"required"`
-	HealthCheckInterval time.Duration `mapstructure:"health_check_interval" validate:"required,gt=0"`
-	HealthCheckTimeout  time.Duration `mapstructure:"health_check_timeout" validate:"required,gt=0"`
-	DialTimeout         time.Duration `mapstructure:"dial_timeout" validate:"required,gt=0"`
-	KeepAlive           time.Duration `mapstructure:"keep_alive" validate:"required,gt=0"`
-	MaxIdleConns        int           `mapstructure:"max_idle_conns" validate:"required,gt=0"`
-	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host" validate:"required,gt=0"`
-	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout" validate:"required,gt=0"`
-	ShutdownTimeout     time.Duration `mapstructure:"shutdown_timeout" validate:"required,gt=0"`
+	Env       Environment `mapstructure:"env"`
+	Mode      Mode        `mapstructure:"mode" validate:"oneof=http tcp"`
+	Port      int         `mapstructure:"port" validate:"required_without=Listeners,omitempty,min=1,max=65535"`
+	Listeners []listener  `mapstructure:"listeners" validate:"unique=Name,dive"`
+	Servers   []server    `mapstructure:"servers" validate:"unique=Address,dive"`
+	// HealthPath is used by servers that don't set their own.
+	HealthPath                   string         `mapstructure:"health_path"`
+	Algorithm                    Algorithm      `mapstructure:"algorithm" validate:"required,oneof=round-robin least-connections"`
+	HealthCheckInterval          time.Duration  `mapstructure:"health_check_interval" validate:"required,gt=0"`
+	HealthCheckTimeout           time.Duration  `mapstructure:"health_check_timeout" validate:"required,gt=0"`
+	HealthCheckUnhealthyInterval time.Duration  `mapstructure:"health_check_unhealthy_interval" validate:"gte=0"`
+	HealthCheckJitterPercent     int            `mapstructure:"health_check_jitter_percent" validate:"min=0,max=50"`
+	HealthCheckMaxConcurrent     int            `mapstructure:"health_check_max_concurrent" validate:"gte=0"`
+	DialTimeout                  time.Duration  `mapstructure:"dial_timeout" validate:"required,gt=0"`
+	KeepAlive                    time.Duration  `mapstructure:"keep_alive" validate:"required,gt=0"`
+	MaxIdleConns                 int            `mapstructure:"max_idle_conns" validate:"required,gt=0"`
+	MaxIdleConnsPerHost          int            `mapstructure:"max_idle_conns_per_host" validate:"required,gt=0"`
+	IdleConnTimeout              time.Duration  `mapstructure:"idle_conn_timeout" validate:"required,gt=0"`
+	TCPIdleTimeout               time.Duration  `mapstructure:"tcp_idle_timeout" validate:"required,gt=0"`
+	ReadHeaderTimeout            time.Duration  `mapstructure:"read_header_timeout" validate:"gte=0"`
+	ReadTimeout                  time.Duration  `mapstructure:"read_timeout" validate:"gte=0"`
+	WriteTimeout                 time.Duration  `mapstructure:"write_timeout" validate:"gte=0"`
+	MaxHeaderBytes               int            `mapstructure:"max_header_bytes" validate:"gte=0"`
+	ResponseHeaderTimeout        time.Duration  `mapstructure:"response_header_timeout" validate:"gte=0"`
+	TrustedProxies               []string       `mapstructure:"trusted_proxies" validate:"dive,cidr"`
+	ShutdownTimeout              time.Duration  `mapstructure:"shutdown_timeout" validate:"required,gt=0"`
+	UpgradeTimeout               time.Duration  `mapstructure:"upgrade_timeout" validate:"gt=0"`
+	ProxyProtocol                proxyProtocol  `mapstructure:"proxy_protocol"`
+	Discovery                    discovery      `mapstructure:"discovery"`
+	StickySessions               stickySessions `mapstructure:"sticky_sessions"`
+	Cache                        cache          `mapstructure:"cache"`
+	Compression                  compression    `mapstructure:"compression"`
+	Admin                        admin          `mapstructure:"admin"`
+	Routes                       []route        `mapstructure:"routes" validate:"unique=Path,dive"`
+	Pools                        []pool         `mapstructure:"pools" validate:"unique=Name,dive"`
+	Locality                     locality       `mapstructure:"locality"`
+	FailoverUnhealthyPercent     int            `mapstructure:"failover_unhealthy_percent" validate:"min=1,max=100"`
+	PanicThresholdPercent        int            `mapstructure:"panic_threshold_percent" validate:"min=0,max=100"`
+	Webhooks                     []webhook      `mapstructure:"webhooks" validate:"dive"`
 }
 
 var configFile = "configs/config.yaml"
 
-func Get() (*Config, error) {
+// envPrefix starts the environment variables that override the config, e.g.
+// LB_STICKY_SESSIONS_ENABLED for sticky_sessions.enabled.
+const envPrefix = "LB"
 
+// Path is the config file to use, CONFIG_PATH or the default one.
+func Path() string {
 	if path, exists := os.LookupEnv("CONFIG_PATH"); exists {
-		configFile = path
+		return path
+	}
+	return configFile
+}
+
+// Load reads the file, applies environment and command line overrides and
+// defaults, and validates the result. Overrides are "key=value" pairs with
+// keys as in the file, e.g. "sticky_sessions.enabled=true".
+func Load(file string, overrides ...string) (*Config, error) {
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetDefault("env", string(Development))
+	v.SetDefault("mode", string(HTTP))
+	v.SetDefault("tcp_idle_timeout", "5m")
+	v.SetDefault("read_header_timeout", "10s")
+	v.SetDefault("upgrade_timeout", "1m")
+	v.SetDefault("health_check_jitter_percent", 10)
+	v.SetDefault("proxy_protocol.header_timeout", "5s")
+	v.SetDefault("sticky_sessions.cookie_name", "lb_affinity")
+	v.SetDefault("sticky_sessions.path", "/")
+	v.SetDefault("sticky_sessions.same_site", "lax")
+	v.SetDefault("cache.max_bytes", 64<<20)
+	v.SetDefault("cache.max_entry_bytes", 1<<20)
+	v.SetDefault("compression.min_size", 1024)
+	v.SetDefault("compression.content_types", []string{
+		"text/", "application/json", "application/javascript", "application/xml", "image/svg+xml",
+	})
+	v.SetDefault("locality.min_healthy_percent", 70)
+	v.SetDefault("failover_unhealthy_percent", 100)
+	v.SetDefault("discovery.refresh_interval", "30s")
+	v.SetDefault("discovery.dns.type", "srv")
+	v.SetDefault("discovery.file.debounce", "1s")
+	v.SetDefault("discovery.consul.address", "http://127.0.0.1:8500")
+	v.SetDefault("discovery.consul.wait_time", "5m")
+	v.SetDefault("discovery.etcd.endpoint", "http://127.0.0.1:2379")
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
-	config, err := loadConfig(configFile)
-	if err != nil {
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	keys := configKeys(reflect.TypeOf(Config{}), "")
+	for _, key := range keys {
+		_ = v.BindEnv(key)
+	}
+	setLegacyEnv(v, keys)
+
+	if servers, ok := os.LookupEnv(envPrefix + "_SERVERS"); ok {
+		setServers(v, servers)
+	}
+	for _, override := range overrides {
+		key, value, _ := strings.Cut(override, "=")
+		if key == "servers" {
+			setServers(v, value)
+			continue
+		}
+		if !slices.Contains(keys, key) {
+			return nil, fmt.Errorf("unknown config key %q", key)
+		}
+		v.Set(key, value)
+	}
+
+	config := Config{}
+	if err := v.Unmarshal(&config); err != nil {
 		return nil, err
 	}
 
-	return config, nil
+	if err := Validate(&config); err != nil {
+		return nil, fmt.Errorf("failed to validate config: %w", err)
+	}
+	return &config, nil
 }
 
-func loadConfig(file string) (*Config, error) {
+// configKeys lists the keys that can be set from the environment. Lists of
+// structs and maps can't, except servers with setServers.
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" {
+			continue
+		}
 
-	viper.SetConfigFile(file)
-	viper.AutomaticEnv()
-	viper.SetDefault("env", string(Development))
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			keys = append(keys, configKeys(field.Type, prefix+tag+".")...)
+		case field.Type.Kind() == reflect.Map:
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+		default:
+			keys = append(keys, prefix+tag)
+		}
+	}
+	return keys
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+// setLegacyEnv applies the unprefixed variables of top-level keys, e.g.
+// PORT, that were read before the LB_ prefix. The prefixed ones win.
+//
+// Deprecated: to be removed once deployments move to the LB_ names.
+func setLegacyEnv(v *viper.Viper, keys []string) {
+	for _, key := range keys {
+		if strings.Contains(key, ".") {
+			continue
+		}
+		name := strings.ToUpper(key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if _, ok := os.LookupEnv(envPrefix + "_" + name); ok {
+			continue
+		}
+		slog.Warn("environment variable without the LB_ prefix is deprecated", "name", name, "use", envPrefix+"_"+name)
+		v.Set(key, value)
 	}
+}
 
-	config := Config{}
-	if err := viper.Unmarshal(&config); err != nil {
-		return nil, err
+// setServers parses the compact server list "address[=weight],...". The
+// servers get the top-level health_path, which is required in http mode.
+// A suffix after the last "=" is only a weight when it is a number, so
+// "=" in an address is kept.
+func setServers(v *viper.Viper, value string) {
+	var servers []map[string]any
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		server := map[string]any{"address": entry}
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			if weight, err := strconv.Atoi(entry[i+1:]); err == nil {
+				server["address"], server["weight"] = entry[:i], weight
+			}
+		}
+		servers = append(servers, server)
 	}
 
+	v.Set("servers", servers)
+}
+
+// Dump writes a loaded config as YAML, with the defaults Validate fills in.
+// Fields tagged `secret:"true"` are masked, `secret:"url"` only loses the
+// password.
+func Dump(w io.Writer, config *Config) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(dumpValue(reflect.ValueOf(config), "")); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// dumpValue turns structs into maps keyed by their mapstructure names, the
+// way the config file is written.
+func dumpValue(v reflect.Value, secret string) any {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return dumpValue(v.Elem(), secret)
+	case reflect.Struct:
+		out := make(map[string]any, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if name := field.Tag.Get("mapstructure"); name != "" {
+				out[name] = dumpValue(v.Field(i), field.Tag.Get("secret"))
+			}
+		}
+		return out
+	case reflect.Slice:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = dumpValue(v.Index(i), secret)
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			out[iter.Key().String()] = dumpValue(iter.Value(), secret)
+		}
+		return out
+	case reflect.String:
+		return maskSecret(v.String(), secret)
+	}
+	return v.Interface()
+}
+
+func maskSecret(value, secret string) string {
+	if value == "" {
+		return value
+	}
+	switch secret {
+	case "true":
+		return "******"
+	case "url":
+		if u, err := url.Parse(value); err == nil {
+			return u.Redacted()
+		}
+		return "******"
+	}
+	return value
+}
+
+// Validate checks the config beyond what the struct tags can express and
+// fills in the server and listener defaults.
+func Validate(config *Config) error {
+
 	validate := validator.New()
 	if err := validate.Struct(config); err != nil {
-		return nil, fmt.Errorf("failed to validate config: %w", err)
+		return err
 	}
 
-	return &config, nil
+	if len(config.Servers) == 0 && config.Discovery.Provider == "" {
+		return errors.New("servers are required when discovery is not configured")
+	}
+
+	if config.ProxyProtocol.SendToBackends && config.Mode != TCP {
+		return errors.New("proxy_protocol.send_to_backends is only supported in tcp mode")
+	}
+
+	defaultHealthPath(config.Servers, config.HealthPath)
+	for _, p := range config.Pools {
+		defaultHealthPath(p.Servers, config.HealthPath)
+	}
+
+	if err := checkServers("servers", config.Servers, config.Mode); err != nil {
+		return err
+	}
+	for _, p := range config.Pools {
+		if err := checkServers("pools["+p.Name+"].servers", p.Servers, config.Mode); err != nil {
+			return err
+		}
+	}
+
+	pools := map[string]bool{DefaultPool: true}
+	for _, p := range config.Pools {
+		pools[p.Name] = true
+	}
+	for _, r := range config.Routes {
+		if r.Mirror != nil && !pools[r.Mirror.Pool] {
+			return fmt.Errorf("routes[%s]: unknown mirror pool %q", r.Path, r.Mirror.Pool)
+		}
+		if r.Split == nil {
+			continue
+		}
+		total := 0
+		for _, b := range r.Split.Pools {
+			if !pools[b.Pool] {
+				return fmt.Errorf("routes[%s]: unknown split pool %q", r.Path, b.Pool)
+			}
+			total += b.Weight
+		}
+		if total == 0 {
+			return fmt.Errorf("routes[%s]: split needs a pool with a positive weight", r.Path)
+		}
+	}
+
+	return checkListeners(config, pools)
+}
+
+func defaultHealthPath(servers []server, healthPath string) {
+	for i := range servers {
+		if servers[i].HealthPath == "" {
+			servers[i].HealthPath = healthPath
+		}
+	}
+}
+
+// checkServers catches addresses that would only fail when a request is
+// proxied to them.
+func checkServers(field string, servers []server, mode Mode) error {
+
+	for i, s := range servers {
+		switch mode {
+		case HTTP:
+			if _, err := backendurl.Parse(s.Address); err != nil {
+				var urlErr *url.Error
+				if errors.As(err, &urlErr) {
+					return fmt.Errorf("%s[%d]: invalid address: %w", field, i, err)
+				}
+				return fmt.Errorf("%s[%d]: address %q: %w", field, i, s.Address, err)
+			}
+			if s.HealthPath == "" {
+				return fmt.Errorf("%s[%d]: health_path is required in http mode, set it for the server or the top-level health_path (%s_HEALTH_PATH)", field, i, envPrefix)
+			}
+			if !strings.HasPrefix(s.HealthPath, "/") {
+				return fmt.Errorf("%s[%d]: health_path must start with /", field, i)
+			}
+		case TCP:
+			if _, _, err := net.SplitHostPort(s.Address); err != nil {
+				return fmt.Errorf("%s[%d]: address %q must be host:port in tcp mode", field, i, s.Address)
+			}
+		}
+	}
+	return nil
+}
+
+// checkListeners validates the listeners and fills in their defaults. Without
+// listeners, the port and mode describe the only one.
+func checkListeners(config *Config, pools map[string]bool) error {
+
+	if len(config.Listeners) == 0 {
+		config.Listeners = []listener{{
+			Name:     "default",
+			Address:  ":" + strconv.Itoa(config.Port),
+			Protocol: Protocol(config.Mode),
+		}}
+	}
+
+	routes := make(map[string]bool, len(config.Routes))
+	for _, r := range config.Routes {
+		routes[r.Path] = true
+	}
+
+	for i := range config.Listeners {
+		l := &config.Listeners[i]
+
+		if l.Protocol == "" {
+			l.Protocol = Protocol(config.Mode)
+		}
+		if l.Pool == "" {
+			l.Pool = DefaultPool
+		}
+		if !pools[l.Pool] {
+			return fmt.Errorf("listeners[%s]: unknown pool %q", l.Name, l.Pool)
+		}
+
+		if l.Protocol == TCPListener {
+			if config.Mode != TCP {
+				return fmt.Errorf("listeners[%s]: tcp listeners are only supported in tcp mode", l.Name)
+			}
+			if len(l.Routes) > 0 {
+				return fmt.Errorf("listeners[%s]: routes are not supported by tcp listeners", l.Name)
+			}
+			if l.IdleTimeout == 0 {
+				l.IdleTimeout = config.TCPIdleTimeout
+			}
+			continue
+		}
+
+		if config.Mode != HTTP {
+			return fmt.Errorf("listeners[%s]: %s listeners are only supported in http mode", l.Name, l.Protocol)
+		}
+		if l.Protocol == HTTPSListener && (l.TLS.CertFile == "" || l.TLS.KeyFile == "") {
+			return fmt.Errorf("listeners[%s]: tls.cert_file and tls.key_file are required for https", l.Name)
+		}
+		for _, path := range l.Routes {
+			if !routes[path] && path != "/" {
+				return fmt.Errorf("listeners[%s]: unknown route %q", l.Name, path)
+			}
+		}
+
+		if l.ReadHeaderTimeout == 0 {
+			l.ReadHeaderTimeout = config.ReadHeaderTimeout
+		}
+		if l.ReadTimeout == 0 {
+			l.ReadTimeout = config.ReadTimeout
+		}
+		if l.WriteTimeout == 0 {
+			l.WriteTimeout = config.WriteTimeout
+		}
+		if l.MaxHeaderBytes == 0 {
+			l.MaxHeaderBytes = config.MaxHeaderBytes
+		}
+	}
+	return nil
 }
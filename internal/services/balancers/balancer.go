@@ -0,0 +1,22 @@
+package balancers
+
+import "test-task/internal/services"
+
+type Balancer interface {
+	NextServer() (*services.ServerInfo, error)
+	Servers() []*services.ServerInfo
+	SetServers(servers []*services.ServerInfo)
+}
+
+// Factory builds a balancer over a subset of servers. Balancers that choose
+// between groups of servers use it to balance within a group with any
+// algorithm.
+type Factory func(servers []*services.ServerInfo) Balancer
+
+func RoundRobin(servers []*services.ServerInfo) Balancer {
+	return NewRoundRobinBalancer(servers)
+}
+
+func LeastConnections(servers []*services.ServerInfo) Balancer {
+	return NewLeastConnectionsBalancer(servers)
+}
@@ -7,6 +7,8 @@ import (
 	"test-task/internal/services"
 )
 
+// LeastConnectionsBalancer picks the healthy server with the fewest active
+// connections relative to its weight.
 type LeastConnectionsBalancer struct {
 	servers []*services.ServerInfo
 	mu      sync.Mutex
@@ -29,8 +31,9 @@ func (r *LeastConnectionsBalancer) NextServer() (*services.ServerInfo, error) {
 			continue
 		}
 
+		// conn/weight < minConn/selectedWeight, compared without division
 		conn := server.Connections()
-		if selected == nil || conn < minConn {
+		if selected == nil || int64(conn)*int64(selected.Weight()) < int64(minConn)*int64(server.Weight()) {
 			selected = server
 			minConn = conn
 		}
@@ -43,3 +46,17 @@ func (r *LeastConnectionsBalancer) NextServer() (*services.ServerInfo, error) {
 	slog.Debug("next server was chosen", "address", selected.Address(), "connections", minConn)
 	return selected, nil
 }
+
+func (r *LeastConnectionsBalancer) SetServers(servers []*services.ServerInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.servers = servers
+}
+
+func (r *LeastConnectionsBalancer) Servers() []*services.ServerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.servers
+}
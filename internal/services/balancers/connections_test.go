@@ -4,13 +4,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"test-task/internal/services"
 	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
 	"testing"
 )
 
 func TestConnectionsNextServer(t *testing.T) {
 	servers := []*services.ServerInfo{
-		services.NewServerInfo("addr1", "/health"),
-		services.NewServerInfo("addr2", "/health"),
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
 	}
 
 	servers[0].IncConnections()
@@ -26,8 +27,8 @@ func TestConnectionsNextServer(t *testing.T) {
 
 func TestConnectionsNextServer_WithUnhealthy(t *testing.T) {
 	servers := []*services.ServerInfo{
-		services.NewServerInfo("addr1", "/health"),
-		services.NewServerInfo("addr2", "/health"),
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
 	}
 
 	servers[0].IncConnections()
@@ -44,8 +45,8 @@ func TestConnectionsNextServer_WithUnhealthy(t *testing.T) {
 
 func TestConnectionsNextServer_NoHealthyServers(t *testing.T) {
 	servers := []*services.ServerInfo{
-		services.NewServerInfo("addr1", "/health"),
-		services.NewServerInfo("addr2", "/health"),
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
 	}
 
 	servers[0].SetHealthy(false)
@@ -62,3 +63,21 @@ func TestConnectionsNextServer_NoServers(t *testing.T) {
 	_, err := b.NextServer()
 	assert.Error(t, err)
 }
+
+func TestConnectionsNextServer_Weighted(t *testing.T) {
+	servers := []*services.ServerInfo{
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
+	}
+
+	servers[0].SetWeight(3)
+	servers[0].IncConnections()
+	servers[0].IncConnections()
+	servers[1].IncConnections()
+
+	b := balancers.NewLeastConnectionsBalancer(servers)
+
+	res, err := b.NextServer()
+	assert.NoError(t, err)
+	assert.True(t, res == servers[0])
+}
@@ -0,0 +1,103 @@
+package balancers
+
+import (
+	"log/slog"
+	"sync"
+	"test-task/internal/services"
+)
+
+// LocalityBalancer sends traffic to servers in its own zone while enough of
+// them are healthy. Once the healthy share of the local zone drops below
+// MinHealthyFraction, traffic spills over to all zones.
+type LocalityBalancer struct {
+	zone               string
+	minHealthyFraction float64
+	factory            Factory
+
+	mu        sync.Mutex
+	servers   []*services.ServerInfo
+	zones     []string
+	local     Balancer
+	all       Balancer
+	spillover bool
+}
+
+func NewLocalityBalancer(servers []*services.ServerInfo, zone string, minHealthyFraction float64, factory Factory) *LocalityBalancer {
+	b := &LocalityBalancer{zone: zone, minHealthyFraction: minHealthyFraction, factory: factory}
+	b.setServers(servers)
+	return b
+}
+
+func (b *LocalityBalancer) NextServer() (*services.ServerInfo, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// zone labels can change without the server list changing
+	if b.zonesChanged() {
+		b.setServers(b.servers)
+	}
+
+	local, healthy := 0, 0
+	for _, server := range b.servers {
+		if server.Zone() != b.zone {
+			continue
+		}
+		local++
+		if server.IsHealthy() {
+			healthy++
+		}
+	}
+
+	spillover := local == 0 || float64(healthy) < b.minHealthyFraction*float64(local)
+	if spillover != b.spillover {
+		b.spillover = spillover
+		slog.Info("locality spillover changed", "zone", b.zone, "spillover", spillover, "local_healthy", healthy, "local", local)
+	}
+
+	if !spillover {
+		if server, err := b.local.NextServer(); err == nil {
+			return server, nil
+		}
+	}
+	return b.all.NextServer()
+}
+
+func (b *LocalityBalancer) SetServers(servers []*services.ServerInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.setServers(servers)
+}
+
+func (b *LocalityBalancer) Servers() []*services.ServerInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.servers
+}
+
+func (b *LocalityBalancer) setServers(servers []*services.ServerInfo) {
+	var local []*services.ServerInfo
+	zones := make([]string, len(servers))
+	for i, server := range servers {
+		zones[i] = server.Zone()
+		if zones[i] == b.zone {
+			local = append(local, server)
+		}
+	}
+
+	b.servers = servers
+	b.zones = zones
+	b.local = b.factory(local)
+	b.all = b.factory(servers)
+}
+
+func (b *LocalityBalancer) zonesChanged() bool {
+	for i, server := range b.servers {
+		if server.Zone() != b.zones[i] {
+			return true
+		}
+	}
+	return false
+}
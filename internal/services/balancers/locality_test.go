@@ -0,0 +1,72 @@
+package balancers_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
+	"testing"
+)
+
+func zonedServer(address, zone string) *services.ServerInfo {
+	server := servicestest.HealthyServer(address, "/health")
+	server.SetLabels(map[string]string{services.ZoneLabel: zone})
+	return server
+}
+
+func pick(t *testing.T, b balancers.Balancer, n int) map[string]int {
+	counts := make(map[string]int)
+	for range n {
+		server, err := b.NextServer()
+		require.NoError(t, err)
+		counts[server.Address()]++
+	}
+	return counts
+}
+
+func TestLocalityBalancer_PrefersLocalZone(t *testing.T) {
+	servers := []*services.ServerInfo{
+		zonedServer("a1", "a"),
+		zonedServer("a2", "a"),
+		zonedServer("b1", "b"),
+	}
+
+	b := balancers.NewLocalityBalancer(servers, "a", 0.5, balancers.RoundRobin)
+	assert.Equal(t, map[string]int{"a1": 2, "a2": 2}, pick(t, b, 4))
+}
+
+func TestLocalityBalancer_SpillsOver(t *testing.T) {
+	servers := []*services.ServerInfo{
+		zonedServer("a1", "a"),
+		zonedServer("a2", "a"),
+		zonedServer("b1", "b"),
+	}
+	b := balancers.NewLocalityBalancer(servers, "a", 0.6, balancers.RoundRobin)
+
+	servers[1].SetHealthy(false)
+	assert.Equal(t, map[string]int{"a1": 2, "b1": 2}, pick(t, b, 4))
+
+	servers[1].SetHealthy(true)
+	assert.Equal(t, map[string]int{"a1": 2, "a2": 2}, pick(t, b, 4))
+}
+
+func TestLocalityBalancer_NoLocalServers(t *testing.T) {
+	servers := []*services.ServerInfo{zonedServer("b1", "b")}
+	b := balancers.NewLocalityBalancer(servers, "a", 0.7, balancers.LeastConnections)
+
+	assert.Equal(t, map[string]int{"b1": 3}, pick(t, b, 3))
+}
+
+func TestLocalityBalancer_ZoneChange(t *testing.T) {
+	servers := []*services.ServerInfo{
+		zonedServer("a1", "a"),
+		zonedServer("b1", "b"),
+	}
+	b := balancers.NewLocalityBalancer(servers, "a", 0.5, balancers.RoundRobin)
+	assert.Equal(t, map[string]int{"a1": 2}, pick(t, b, 2))
+
+	servers[0].SetLabels(map[string]string{services.ZoneLabel: "b"})
+	servers[1].SetLabels(map[string]string{services.ZoneLabel: "a"})
+	assert.Equal(t, map[string]int{"b1": 2}, pick(t, b, 2))
+}
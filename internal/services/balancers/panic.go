@@ -0,0 +1,84 @@
+package balancers
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"test-task/internal/services"
+)
+
+// PanicBalancer guards against a flapping health check taking the whole pool
+// out of rotation. When the healthy share of servers drops below Threshold it
+// ignores health and spreads requests over all servers, since some of them
+// are likely fine. With priority levels only the level in use after failover
+// counts, so healthy backups are preferred to panicking.
+type PanicBalancer struct {
+	threshold float64
+	inner     Balancer
+
+	mu            sync.Mutex
+	next          int
+	panicking     atomic.Bool
+	panicRequests atomic.Int64
+}
+
+func NewPanicBalancer(inner Balancer, threshold float64) *PanicBalancer {
+	return &PanicBalancer{inner: inner, threshold: threshold}
+}
+
+type activeServers interface {
+	ActiveServers() []*services.ServerInfo
+}
+
+func (b *PanicBalancer) NextServer() (*services.ServerInfo, error) {
+
+	var servers []*services.ServerInfo
+	if inner, ok := b.inner.(activeServers); ok {
+		servers = inner.ActiveServers()
+	} else {
+		servers = b.inner.Servers()
+	}
+	healthy := countHealthy(servers)
+
+	panicking := len(servers) > 0 && float64(healthy) < b.threshold*float64(len(servers))
+	if b.panicking.Swap(panicking) != panicking {
+		if panicking {
+			slog.Warn("panic mode active, ignoring health checks", "healthy", healthy, "total", len(servers))
+		} else {
+			slog.Info("panic mode ended", "healthy", healthy, "total", len(servers))
+		}
+	}
+
+	if !panicking {
+		return b.inner.NextServer()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(servers) == 0 {
+		return nil, errors.New("no servers available")
+	}
+	server := servers[b.next%len(servers)]
+	b.next++
+	b.panicRequests.Add(1)
+	return server, nil
+}
+
+func (b *PanicBalancer) SetServers(servers []*services.ServerInfo) {
+	b.inner.SetServers(servers)
+}
+
+func (b *PanicBalancer) Servers() []*services.ServerInfo {
+	return b.inner.Servers()
+}
+
+func (b *PanicBalancer) InPanic() bool {
+	return b.panicking.Load()
+}
+
+// PanicRequests is the number of requests routed while in panic mode.
+func (b *PanicBalancer) PanicRequests() int64 {
+	return b.panicRequests.Load()
+}
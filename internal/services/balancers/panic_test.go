@@ -0,0 +1,64 @@
+package balancers_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
+	"testing"
+)
+
+func TestPanicBalancer(t *testing.T) {
+	servers := []*services.ServerInfo{
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
+		servicestest.HealthyServer("addr3", "/health"),
+		servicestest.HealthyServer("addr4", "/health"),
+	}
+	b := balancers.NewPanicBalancer(balancers.NewRoundRobinBalancer(servers), 0.5)
+
+	// at the threshold health is still respected
+	servers[0].SetHealthy(false)
+	servers[1].SetHealthy(false)
+	assert.Equal(t, map[string]int{"addr3": 2, "addr4": 2}, pick(t, b, 4))
+	assert.False(t, b.InPanic())
+
+	servers[2].SetHealthy(false)
+	servers[3].SetHealthy(false)
+	assert.Equal(t, map[string]int{"addr1": 1, "addr2": 1, "addr3": 1, "addr4": 1}, pick(t, b, 4))
+	assert.True(t, b.InPanic())
+	assert.Equal(t, int64(4), b.PanicRequests())
+
+	servers[0].SetHealthy(true)
+	servers[1].SetHealthy(true)
+	assert.Equal(t, map[string]int{"addr1": 2, "addr2": 2}, pick(t, b, 4))
+	assert.False(t, b.InPanic())
+}
+
+func TestPanicBalancer_NoServers(t *testing.T) {
+	b := balancers.NewPanicBalancer(balancers.NewRoundRobinBalancer(nil), 0.5)
+
+	_, err := b.NextServer()
+	assert.Error(t, err)
+}
+
+func TestPanicBalancer_PrefersHealthyBackup(t *testing.T) {
+	servers := []*services.ServerInfo{
+		prioritizedServer("p0-a", 0, false),
+		prioritizedServer("p0-b", 0, false),
+		prioritizedServer("p0-c", 0, false),
+		prioritizedServer("backup", 0, true),
+	}
+	b := balancers.NewPanicBalancer(balancers.NewPriorityBalancer(servers, 1, balancers.RoundRobin), 0.5)
+
+	for _, server := range servers[:3] {
+		server.SetHealthy(false)
+	}
+	assert.Equal(t, map[string]int{"backup": 4}, pick(t, b, 4))
+	assert.False(t, b.InPanic())
+
+	// nothing healthy left, all servers share the traffic
+	servers[3].SetHealthy(false)
+	assert.Equal(t, map[string]int{"p0-a": 1, "p0-b": 1, "p0-c": 1, "backup": 1}, pick(t, b, 4))
+	assert.True(t, b.InPanic())
+}
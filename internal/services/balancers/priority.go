@@ -0,0 +1,154 @@
+package balancers
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"test-task/internal/services"
+)
+
+// PriorityBalancer groups servers into levels by priority, with backup
+// servers after all regular ones. Traffic goes to the first level whose
+// unhealthy share is below FailoverFraction, together with the healthy
+// servers left in the levels before it, and returns to the preferred level as
+// soon as it recovers.
+type PriorityBalancer struct {
+	failoverFraction float64
+	factory          Factory
+
+	mu      sync.Mutex
+	servers []*services.ServerInfo
+	keys    []int64
+	levels  [][]*services.ServerInfo
+	// upTo[i] balances over levels 0..i
+	upTo   []Balancer
+	active int
+}
+
+func NewPriorityBalancer(servers []*services.ServerInfo, failoverFraction float64, factory Factory) *PriorityBalancer {
+	b := &PriorityBalancer{failoverFraction: failoverFraction, factory: factory}
+	b.setServers(servers)
+	return b
+}
+
+func (b *PriorityBalancer) NextServer() (*services.ServerInfo, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	active := b.activeLevel()
+	if active < 0 {
+		return b.factory(nil).NextServer()
+	}
+
+	if active > b.active {
+		slog.Warn("failing over to lower priority", "from", b.active, "to", active)
+	} else if active < b.active {
+		slog.Info("returning to higher priority", "from", b.active, "to", active)
+	}
+	b.active = active
+	return b.upTo[active].NextServer()
+}
+
+// ActiveServers are the servers of the level traffic goes to, or all servers
+// when no level has a healthy one.
+func (b *PriorityBalancer) ActiveServers() []*services.ServerInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	active := b.activeLevel()
+	if active < 0 || countHealthy(b.levels[active]) == 0 {
+		return b.servers
+	}
+	return b.levels[active]
+}
+
+// activeLevel must be called with mu held.
+func (b *PriorityBalancer) activeLevel() int {
+	// priorities can change without the server list changing
+	if b.keysChanged() {
+		b.setServers(b.servers)
+	}
+
+	for i, level := range b.levels {
+		healthy := countHealthy(level)
+		unhealthy := len(level) - healthy
+		if healthy > 0 && float64(unhealthy) < b.failoverFraction*float64(len(level)) {
+			return i
+		}
+	}
+	return len(b.levels) - 1
+}
+
+func countHealthy(servers []*services.ServerInfo) int {
+	healthy := 0
+	for _, server := range servers {
+		if server.IsHealthy() {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+func (b *PriorityBalancer) SetServers(servers []*services.ServerInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.setServers(servers)
+}
+
+func (b *PriorityBalancer) Servers() []*services.ServerInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.servers
+}
+
+func (b *PriorityBalancer) setServers(servers []*services.ServerInfo) {
+	keys := make([]int64, len(servers))
+	for i, server := range servers {
+		keys[i] = priorityKey(server)
+	}
+
+	levelKeys := slices.Clone(keys)
+	slices.Sort(levelKeys)
+	levelKeys = slices.Compact(levelKeys)
+
+	levels := make([][]*services.ServerInfo, len(levelKeys))
+	for i, server := range servers {
+		level, _ := slices.BinarySearch(levelKeys, keys[i])
+		levels[level] = append(levels[level], server)
+	}
+
+	upTo := make([]Balancer, len(levels))
+	var cumulative []*services.ServerInfo
+	for i, level := range levels {
+		cumulative = append(cumulative, level...)
+		upTo[i] = b.factory(slices.Clone(cumulative))
+	}
+
+	b.servers = servers
+	b.keys = keys
+	b.levels = levels
+	b.upTo = upTo
+	if b.active >= len(levels) {
+		b.active = 0
+	}
+}
+
+func (b *PriorityBalancer) keysChanged() bool {
+	for i, server := range b.servers {
+		if priorityKey(server) != b.keys[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func priorityKey(server *services.ServerInfo) int64 {
+	key := int64(server.Priority())
+	if server.IsBackup() {
+		key += 1 << 32
+	}
+	return key
+}
@@ -0,0 +1,78 @@
+package balancers_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
+	"testing"
+)
+
+func prioritizedServer(address string, priority int, backup bool) *services.ServerInfo {
+	server := servicestest.HealthyServer(address, "/health")
+	server.SetPriority(priority)
+	server.SetBackup(backup)
+	return server
+}
+
+func TestPriorityBalancer_FailoverWhenAllUnhealthy(t *testing.T) {
+	servers := []*services.ServerInfo{
+		prioritizedServer("backup", 0, true),
+		prioritizedServer("p0-a", 0, false),
+		prioritizedServer("p0-b", 0, false),
+		prioritizedServer("p1", 1, false),
+	}
+	b := balancers.NewPriorityBalancer(servers, 1, balancers.RoundRobin)
+
+	assert.Equal(t, map[string]int{"p0-a": 2, "p0-b": 2}, pick(t, b, 4))
+
+	servers[1].SetHealthy(false)
+	assert.Equal(t, map[string]int{"p0-b": 4}, pick(t, b, 4))
+
+	servers[2].SetHealthy(false)
+	assert.Equal(t, map[string]int{"p1": 2}, pick(t, b, 2))
+
+	servers[3].SetHealthy(false)
+	assert.Equal(t, map[string]int{"backup": 2}, pick(t, b, 2))
+
+	// automatic return once the primary group recovers
+	servers[1].SetHealthy(true)
+	assert.Equal(t, map[string]int{"p0-a": 2}, pick(t, b, 2))
+}
+
+func TestPriorityBalancer_FailoverFraction(t *testing.T) {
+	servers := []*services.ServerInfo{
+		prioritizedServer("p0-a", 0, false),
+		prioritizedServer("p0-b", 0, false),
+		prioritizedServer("backup", 0, true),
+	}
+	b := balancers.NewPriorityBalancer(servers, 0.5, balancers.RoundRobin)
+
+	// half of the primaries down, the remaining one shares with the backup
+	servers[0].SetHealthy(false)
+	assert.Equal(t, map[string]int{"p0-b": 2, "backup": 2}, pick(t, b, 4))
+}
+
+func TestPriorityBalancer_PriorityChange(t *testing.T) {
+	servers := []*services.ServerInfo{
+		prioritizedServer("a", 0, false),
+		prioritizedServer("b", 1, false),
+	}
+	b := balancers.NewPriorityBalancer(servers, 1, balancers.LeastConnections)
+	assert.Equal(t, map[string]int{"a": 2}, pick(t, b, 2))
+
+	servers[0].SetPriority(2)
+	assert.Equal(t, map[string]int{"b": 2}, pick(t, b, 2))
+}
+
+func TestPriorityBalancer_NoHealthyServers(t *testing.T) {
+	servers := []*services.ServerInfo{prioritizedServer("a", 0, false)}
+	servers[0].SetHealthy(false)
+	b := balancers.NewPriorityBalancer(servers, 1, balancers.RoundRobin)
+
+	_, err := b.NextServer()
+	assert.Error(t, err)
+
+	_, err = balancers.NewPriorityBalancer(nil, 1, balancers.RoundRobin).NextServer()
+	assert.Error(t, err)
+}
@@ -7,14 +7,17 @@ import (
 	"test-task/internal/services"
 )
 
+// RoundRobinBalancer implements smooth weighted round-robin: servers with
+// equal weights are picked in order, heavier servers are picked more often
+// but never in long bursts.
 type RoundRobinBalancer struct {
-	servers            []*services.ServerInfo
-	currentServerIndex int32
-	mu                 sync.Mutex
+	servers        []*services.ServerInfo
+	currentWeights map[*services.ServerInfo]int
+	mu             sync.Mutex
 }
 
 func NewRoundRobinBalancer(servers []*services.ServerInfo) *RoundRobinBalancer {
-	return &RoundRobinBalancer{servers: servers, currentServerIndex: -1}
+	return &RoundRobinBalancer{servers: servers, currentWeights: make(map[*services.ServerInfo]int)}
 }
 
 func (r *RoundRobinBalancer) NextServer() (*services.ServerInfo, error) {
@@ -22,20 +25,48 @@ func (r *RoundRobinBalancer) NextServer() (*services.ServerInfo, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	totalServers := len(r.servers)
-	if totalServers == 0 {
+	if len(r.servers) == 0 {
 		return nil, errors.New("no servers available")
 	}
 
-	for i := 0; i < totalServers; i++ {
-		r.currentServerIndex = (r.currentServerIndex + 1) % int32(totalServers)
-		server := r.servers[r.currentServerIndex]
+	var selected *services.ServerInfo
+	totalWeight := 0
 
-		if checkServer(server) {
-			slog.Debug("next server was chosen", "address", server.Address(), "index", r.currentServerIndex)
-			return server, nil
+	for _, server := range r.servers {
+		if !checkServer(server) {
+			continue
 		}
+
+		weight := server.Weight()
+		r.currentWeights[server] += weight
+		totalWeight += weight
+
+		if selected == nil || r.currentWeights[server] > r.currentWeights[selected] {
+			selected = server
+		}
+	}
+
+	if selected == nil {
+		return nil, errors.New("no healthy servers found")
 	}
 
-	return nil, errors.New("no healthy servers found")
+	r.currentWeights[selected] -= totalWeight
+
+	slog.Debug("next server was chosen", "address", selected.Address(), "weight", selected.Weight())
+	return selected, nil
+}
+
+func (r *RoundRobinBalancer) SetServers(servers []*services.ServerInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.servers = servers
+	r.currentWeights = make(map[*services.ServerInfo]int, len(servers))
+}
+
+func (r *RoundRobinBalancer) Servers() []*services.ServerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.servers
 }
@@ -4,13 +4,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"test-task/internal/services"
 	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
 	"testing"
 )
 
 func TestRoundRobinNextServer(t *testing.T) {
 	servers := []*services.ServerInfo{
-		services.NewServerInfo("addr1", "/health"),
-		services.NewServerInfo("addr2", "/health"),
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
 	}
 
 	b := balancers.NewRoundRobinBalancer(servers)
@@ -30,9 +31,9 @@ func TestRoundRobinNextServer(t *testing.T) {
 
 func TestRoundRobinNextServer_WithUnhealthy(t *testing.T) {
 	servers := []*services.ServerInfo{
-		services.NewServerInfo("addr1", "/health"),
-		services.NewServerInfo("addr2", "/health"),
-		services.NewServerInfo("addr2", "/health"),
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
 	}
 
 	servers[1].SetHealthy(false)
@@ -54,8 +55,8 @@ func TestRoundRobinNextServer_WithUnhealthy(t *testing.T) {
 
 func TestRoundRobinNextServer_NoHealthyServers(t *testing.T) {
 	servers := []*services.ServerInfo{
-		services.NewServerInfo("addr1", "/health"),
-		services.NewServerInfo("addr2", "/health"),
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
 	}
 
 	servers[0].SetHealthy(false)
@@ -72,3 +73,39 @@ func TestRoundRobinNextServer_NoServers(t *testing.T) {
 	_, err := b.NextServer()
 	assert.Error(t, err)
 }
+
+func TestRoundRobinNextServer_Weighted(t *testing.T) {
+	servers := []*services.ServerInfo{
+		servicestest.HealthyServer("addr1", "/health"),
+		servicestest.HealthyServer("addr2", "/health"),
+	}
+	servers[0].SetWeight(2)
+
+	b := balancers.NewRoundRobinBalancer(servers)
+
+	expected := []*services.ServerInfo{servers[0], servers[1], servers[0], servers[0], servers[1], servers[0]}
+	for _, e := range expected {
+		res, err := b.NextServer()
+		assert.NoError(t, err)
+		assert.True(t, res == e)
+	}
+}
+
+func TestRoundRobinNextServer_SetServers(t *testing.T) {
+	servers := []*services.ServerInfo{
+		servicestest.HealthyServer("addr1", "/health"),
+	}
+
+	b := balancers.NewRoundRobinBalancer(servers)
+
+	res, err := b.NextServer()
+	assert.NoError(t, err)
+	assert.True(t, res == servers[0])
+
+	updated := servicestest.HealthyServer("addr2", "/health")
+	b.SetServers([]*services.ServerInfo{updated})
+
+	res, err = b.NextServer()
+	assert.NoError(t, err)
+	assert.True(t, res == updated)
+}
@@ -0,0 +1,10 @@
+package services
+
+import "context"
+
+// Discovery keeps a Pool in sync with an external source of backends.
+// Run blocks until ctx is cancelled, WaitForStop returns after Run exits.
+type Discovery interface {
+	Run(ctx context.Context, pool *Pool)
+	WaitForStop()
+}
@@ -0,0 +1,194 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"test-task/internal/services"
+	"time"
+)
+
+type ConsulConfig struct {
+	Address       string `validate:"required,url"`
+	Service       string `validate:"required"`
+	Tag           string
+	Datacenter    string
+	Token         string
+	Scheme        string // prepended to service addresses, empty in tcp mode
+	HealthPath    string
+	WaitTime      time.Duration `validate:"required,gt=0"`
+	RetryInterval time.Duration `validate:"required,gt=0"`
+}
+
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Meta    map[string]string
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+// Consul watches the health-passing instances of a service in the Consul
+// catalog using blocking queries.
+type Consul struct {
+	config ConsulConfig
+	client *http.Client
+	done   chan struct{}
+}
+
+var _ services.Discovery = (*Consul)(nil)
+
+func NewConsul(config ConsulConfig) (*Consul, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	// Consul may hold a blocking query for up to WaitTime plus WaitTime/16
+	// of jitter, the client timeout has to leave room for that.
+	timeout := config.WaitTime + config.WaitTime/16 + 10*time.Second
+
+	return &Consul{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+		done:   make(chan struct{}, 1),
+	}, nil
+}
+
+func (c *Consul) Run(ctx context.Context, pool *services.Pool) {
+
+	defer func() { c.done <- struct{}{} }()
+
+	var index uint64
+	for {
+		targets, newIndex, err := c.Query(ctx, index)
+		if ctx.Err() != nil {
+			slog.Info("consul discovery stopped")
+			return
+		}
+
+		if err != nil {
+			slog.Error("consul discovery failed, keeping current servers", "service", c.config.Service, "error", err)
+			index = 0
+			if !sleep(ctx, c.config.RetryInterval) {
+				slog.Info("consul discovery stopped")
+				return
+			}
+			continue
+		}
+
+		// The index must only grow, Consul docs require a reset otherwise.
+		if newIndex < index {
+			newIndex = 0
+		}
+		index = newIndex
+
+		if len(targets) == 0 {
+			slog.Error("consul discovery found no passing instances, keeping current servers", "service", c.config.Service)
+			continue
+		}
+		pool.Update(targets)
+	}
+}
+
+func (c *Consul) WaitForStop() {
+	<-c.done
+}
+
+// Query returns passing instances of the service. With a non-zero index the
+// request blocks until the result changes or the wait time passes.
+func (c *Consul) Query(ctx context.Context, index uint64) ([]services.Target, uint64, error) {
+
+	query := url.Values{}
+	query.Set("passing", "true")
+	if c.config.Tag != "" {
+		query.Set("tag", c.config.Tag)
+	}
+	if c.config.Datacenter != "" {
+		query.Set("dc", c.config.Datacenter)
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.config.WaitTime.String())
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/health/service/%s?%s", c.config.Address, url.PathEscape(c.config.Service), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	newIndex, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid X-Consul-Index: %w", err)
+	}
+
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	targets := make([]services.Target, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+
+		targets = append(targets, services.Target{
+			Address:    buildAddress(c.config.Scheme, net.JoinHostPort(host, strconv.Itoa(e.Service.Port))),
+			HealthPath: c.config.HealthPath,
+			Weight:     e.Service.Weights.Passing,
+			Labels:     e.Service.Meta,
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Address < targets[j].Address })
+
+	return targets, newIndex, nil
+}
+
+func buildAddress(scheme, hostPort string) string {
+	if scheme == "" {
+		return hostPort
+	}
+	return scheme + "://" + hostPort
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
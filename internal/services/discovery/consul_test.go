@@ -0,0 +1,155 @@
+package discovery_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"test-task/internal/services"
+	"test-task/internal/services/discovery"
+	"testing"
+	"time"
+)
+
+type consulInstance struct {
+	address string
+	port    int
+	weight  int
+	meta    map[string]string
+}
+
+// fakeConsul serves /v1/health/service/<name> with blocking query support.
+type fakeConsul struct {
+	mu        sync.Mutex
+	index     uint64
+	instances []consulInstance
+	changed   chan struct{}
+	requests  []string
+}
+
+func newFakeConsul(t *testing.T) (*fakeConsul, *httptest.Server) {
+	c := &fakeConsul{index: 1, changed: make(chan struct{})}
+	srv := httptest.NewServer(http.HandlerFunc(c.handle))
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+func (c *fakeConsul) set(instances ...consulInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.instances = instances
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsul) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/health/service/web" || r.URL.Query().Get("passing") != "true" {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.mu.Lock()
+	c.requests = append(c.requests, r.URL.RawQuery)
+	index, changed := c.index, c.changed
+	c.mu.Unlock()
+
+	if requested, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); requested == index {
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]map[string]any, 0, len(c.instances))
+	for _, i := range c.instances {
+		entries = append(entries, map[string]any{
+			"Node": map[string]any{"Address": "10.0.0.100"},
+			"Service": map[string]any{
+				"Address": i.address,
+				"Port":    i.port,
+				"Meta":    i.meta,
+				"Weights": map[string]any{"Passing": i.weight, "Warning": 1},
+			},
+		})
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func TestConsul_Query(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	fake.set(
+		consulInstance{address: "10.0.0.2", port: 8080, weight: 3, meta: map[string]string{"zone": "a"}},
+		consulInstance{address: "", port: 9090, weight: 1},
+	)
+
+	c, err := discovery.NewConsul(discovery.ConsulConfig{
+		Address:       srv.URL,
+		Service:       "web",
+		Scheme:        "http",
+		HealthPath:    "/health",
+		WaitTime:      time.Second,
+		RetryInterval: time.Second,
+	})
+	require.NoError(t, err)
+
+	targets, index, err := c.Query(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), index)
+	assert.Equal(t, []services.Target{
+		{Address: "http://10.0.0.100:9090", HealthPath: "/health", Weight: 1},
+		{Address: "http://10.0.0.2:8080", HealthPath: "/health", Weight: 3, Labels: map[string]string{"zone": "a"}},
+	}, targets)
+}
+
+func TestConsul_BlockingQueryUpdatesPool(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	fake.set(consulInstance{address: "10.0.0.1", port: 8080}, consulInstance{address: "10.0.0.2", port: 8080})
+
+	c, err := discovery.NewConsul(discovery.ConsulConfig{
+		Address:       srv.URL,
+		Service:       "web",
+		WaitTime:      5 * time.Second,
+		RetryInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	pool := services.NewPool(nil)
+	updates := make(chan []*services.ServerInfo, 10)
+	pool.OnChange(func(servers []*services.ServerInfo) { updates <- servers })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Run(ctx, pool)
+	defer func() {
+		cancel()
+		c.WaitForStop()
+	}()
+
+	first := waitForUpdate(t, updates)
+	require.Len(t, first, 2)
+	first[1].SetHealthy(false)
+
+	fake.set(consulInstance{address: "10.0.0.2", port: 8080})
+
+	second := waitForUpdate(t, updates)
+	require.Len(t, second, 1)
+	assert.Same(t, first[1], second[0])
+	assert.False(t, second[0].IsHealthy())
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Contains(t, fake.requests, "index=2&passing=true&wait=5s")
+}
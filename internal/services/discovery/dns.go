@@ -0,0 +1,133 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"test-task/internal/services"
+	"time"
+)
+
+type RecordType string
+
+const (
+	SRV RecordType = "srv"
+	A   RecordType = "a"
+)
+
+type DNSConfig struct {
+	Name            string     `validate:"required"`
+	Type            RecordType `validate:"oneof=srv a"`
+	Port            int        `validate:"required_if=Type a,max=65535"`
+	Scheme          string     // prepended to resolved addresses, empty in tcp mode
+	HealthPath      string
+	Server          string        // DNS server address, the system resolver is used if empty
+	RefreshInterval time.Duration `validate:"required,gt=0"`
+}
+
+// DNS periodically resolves SRV or A/AAAA records into the server pool.
+type DNS struct {
+	config   DNSConfig
+	resolver *net.Resolver
+	done     chan struct{}
+}
+
+var _ services.Discovery = (*DNS)(nil)
+
+func NewDNS(config DNSConfig) (*DNS, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	resolver := net.DefaultResolver
+	if config.Server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, config.Server)
+			},
+		}
+	}
+
+	return &DNS{config: config, resolver: resolver, done: make(chan struct{}, 1)}, nil
+}
+
+func (d *DNS) Run(ctx context.Context, pool *services.Pool) {
+
+	ticker := time.NewTicker(d.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		d.refresh(ctx, pool)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("dns discovery stopped")
+			d.done <- struct{}{}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *DNS) WaitForStop() {
+	<-d.done
+}
+
+func (d *DNS) refresh(ctx context.Context, pool *services.Pool) {
+	targets, err := d.Resolve(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("dns discovery failed, keeping current servers", "name", d.config.Name, "error", err)
+		}
+		return
+	}
+	pool.Update(targets)
+}
+
+func (d *DNS) Resolve(ctx context.Context) ([]services.Target, error) {
+
+	var hostPorts []string
+
+	switch d.config.Type {
+	case SRV:
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", d.config.Name)
+		if err != nil {
+			return nil, fmt.Errorf("srv lookup failed: %w", err)
+		}
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			hostPorts = append(hostPorts, net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+		}
+	case A:
+		addrs, err := d.resolver.LookupIPAddr(ctx, d.config.Name)
+		if err != nil {
+			return nil, fmt.Errorf("address lookup failed: %w", err)
+		}
+		for _, addr := range addrs {
+			hostPorts = append(hostPorts, net.JoinHostPort(addr.IP.String(), strconv.Itoa(d.config.Port)))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", d.config.Type)
+	}
+
+	if len(hostPorts) == 0 {
+		return nil, errors.New("no records found")
+	}
+	sort.Strings(hostPorts)
+
+	targets := make([]services.Target, len(hostPorts))
+	for i, hostPort := range hostPorts {
+		targets[i] = services.Target{Address: buildAddress(d.config.Scheme, hostPort), HealthPath: d.config.HealthPath}
+	}
+	return targets, nil
+}
@@ -0,0 +1,210 @@
+package discovery_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"sync"
+	"test-task/internal/services"
+	"test-task/internal/services/discovery"
+	"testing"
+	"time"
+)
+
+type srvRecord struct {
+	target string
+	port   uint16
+}
+
+// dnsStub is a minimal UDP DNS server answering A and SRV queries from
+// in-memory records that tests can change at any time.
+type dnsStub struct {
+	conn net.PacketConn
+
+	mu  sync.Mutex
+	a   map[string][]net.IP
+	srv map[string][]srvRecord
+}
+
+func newDNSStub(t *testing.T) *dnsStub {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	stub := &dnsStub{conn: conn, a: map[string][]net.IP{}, srv: map[string][]srvRecord{}}
+	go stub.serve()
+	t.Cleanup(func() { _ = conn.Close() })
+	return stub
+}
+
+func (s *dnsStub) setA(name string, ips ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.a[name] = nil
+	for _, ip := range ips {
+		s.a[name] = append(s.a[name], net.ParseIP(ip))
+	}
+}
+
+func (s *dnsStub) setSRV(name string, records ...srvRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.srv[name] = records
+}
+
+func (s *dnsStub) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+			continue
+		}
+
+		answer := s.answer(msg)
+		resp, err := answer.Pack()
+		if err != nil {
+			continue
+		}
+		_, _ = s.conn.WriteTo(resp, addr)
+	}
+}
+
+func (s *dnsStub) answer(query dnsmessage.Message) dnsmessage.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := query.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+		Questions: query.Questions,
+	}
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 1}
+
+	switch q.Type {
+	case dnsmessage.TypeA:
+		for _, ip := range s.a[q.Name.String()] {
+			h := rh
+			h.Type = dnsmessage.TypeA
+			var a [4]byte
+			copy(a[:], ip.To4())
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: h, Body: &dnsmessage.AResource{A: a}})
+		}
+	case dnsmessage.TypeSRV:
+		for _, r := range s.srv[q.Name.String()] {
+			h := rh
+			h.Type = dnsmessage.TypeSRV
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: h, Body: &dnsmessage.SRVResource{
+				Target: dnsmessage.MustNewName(r.target),
+				Port:   r.port,
+			}})
+		}
+	}
+
+	if len(resp.Answers) == 0 && q.Type != dnsmessage.TypeAAAA {
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+	return resp
+}
+
+func TestDNS_ResolveSRV(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.setSRV("_http._tcp.backend.test.",
+		srvRecord{target: "b.backend.test.", port: 8081},
+		srvRecord{target: "a.backend.test.", port: 8080})
+
+	d, err := discovery.NewDNS(discovery.DNSConfig{
+		Name:            "_http._tcp.backend.test.",
+		Type:            discovery.SRV,
+		Scheme:          "http",
+		HealthPath:      "/health",
+		Server:          stub.conn.LocalAddr().String(),
+		RefreshInterval: time.Second,
+	})
+	require.NoError(t, err)
+
+	targets, err := d.Resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []services.Target{
+		{Address: "http://a.backend.test:8080", HealthPath: "/health"},
+		{Address: "http://b.backend.test:8081", HealthPath: "/health"},
+	}, targets)
+}
+
+func TestDNS_RefreshKeepsExistingServers(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.setA("backend.test.", "10.0.0.1", "10.0.0.2")
+
+	d, err := discovery.NewDNS(discovery.DNSConfig{
+		Name:            "backend.test.",
+		Type:            discovery.A,
+		Port:            9000,
+		Server:          stub.conn.LocalAddr().String(),
+		RefreshInterval: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	pool := services.NewPool(nil)
+	updates := make(chan []*services.ServerInfo, 10)
+	pool.OnChange(func(servers []*services.ServerInfo) { updates <- servers })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go d.Run(ctx, pool)
+	defer func() {
+		cancel()
+		d.WaitForStop()
+	}()
+
+	var first []*services.ServerInfo
+	select {
+	case first = <-updates:
+	case <-time.After(2 * time.Second):
+		t.Fatal("pool was not updated")
+	}
+	require.Len(t, first, 2)
+	assert.Equal(t, "10.0.0.1:9000", first[0].Address())
+
+	first[0].IncConnections()
+	first[0].SetHealthy(false)
+	stub.setA("backend.test.", "10.0.0.1", "10.0.0.3")
+
+	var second []*services.ServerInfo
+	select {
+	case second = <-updates:
+	case <-time.After(2 * time.Second):
+		t.Fatal("pool was not updated")
+	}
+	require.Len(t, second, 2)
+	assert.Same(t, first[0], second[0])
+	assert.Equal(t, int32(1), second[0].Connections())
+	assert.False(t, second[0].IsHealthy())
+	assert.Equal(t, "10.0.0.3:9000", second[1].Address())
+}
+
+func TestDNS_ResolveMissingName(t *testing.T) {
+	stub := newDNSStub(t)
+
+	d, err := discovery.NewDNS(discovery.DNSConfig{
+		Name:            "missing.test.",
+		Type:            discovery.A,
+		Port:            9000,
+		Server:          stub.conn.LocalAddr().String(),
+		RefreshInterval: time.Second,
+	})
+	require.NoError(t, err)
+
+	_, err = d.Resolve(context.Background())
+	assert.Error(t, err)
+}
+
+func TestNewDNS_InvalidConfig(t *testing.T) {
+	_, err := discovery.NewDNS(discovery.DNSConfig{Name: "backend.test.", Type: discovery.A, RefreshInterval: time.Second})
+	assert.Error(t, err)
+}
@@ -0,0 +1,274 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"test-task/internal/services"
+	"time"
+)
+
+type EtcdConfig struct {
+	Endpoint      string        `validate:"required,url"`
+	Prefix        string        `validate:"required"`
+	HealthPath    string        // used for values that don't set their own
+	RetryInterval time.Duration `validate:"required,gt=0"`
+}
+
+// etcdValue is the value stored under each key. A plain string value is
+// treated as the server address.
+type etcdValue struct {
+	Address    string            `json:"address"`
+	Weight     int               `json:"weight"`
+	Labels     map[string]string `json:"labels"`
+	HealthPath string            `json:"health_path"`
+}
+
+type etcdKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader     `json:"header"`
+	Kvs    []etcdKeyValue `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Header   etcdHeader        `json:"header"`
+		Canceled bool              `json:"canceled"`
+		Events   []json.RawMessage `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Etcd reads servers from all keys under a prefix using the etcd v3 JSON
+// gateway and re-reads them whenever a watch on the prefix reports changes.
+type Etcd struct {
+	config EtcdConfig
+	client *http.Client
+	done   chan struct{}
+}
+
+var _ services.Discovery = (*Etcd)(nil)
+
+func NewEtcd(config EtcdConfig) (*Etcd, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &Etcd{config: config, client: &http.Client{}, done: make(chan struct{}, 1)}, nil
+}
+
+func (e *Etcd) Run(ctx context.Context, pool *services.Pool) {
+
+	defer func() { e.done <- struct{}{} }()
+
+	for {
+		err := e.sync(ctx, pool)
+		if ctx.Err() != nil {
+			slog.Info("etcd discovery stopped")
+			return
+		}
+
+		slog.Error("etcd discovery failed, keeping current servers", "prefix", e.config.Prefix, "error", err)
+		if !sleep(ctx, e.config.RetryInterval) {
+			slog.Info("etcd discovery stopped")
+			return
+		}
+	}
+}
+
+func (e *Etcd) WaitForStop() {
+	<-e.done
+}
+
+// sync loads the prefix and then follows a watch on it until an error occurs.
+func (e *Etcd) sync(ctx context.Context, pool *services.Pool) error {
+
+	targets, revision, err := e.Load(ctx)
+	if err != nil {
+		return err
+	}
+	e.update(pool, targets)
+
+	body, err := json.Marshal(map[string]any{
+		"create_request": map[string]string{
+			"key":            encodeKey(e.config.Prefix),
+			"range_end":      encodeKey(prefixEnd(e.config.Prefix)),
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.post(ctx, "/v3/watch", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg etcdWatchResponse
+		if err := decoder.Decode(&msg); err != nil {
+			return fmt.Errorf("watch interrupted: %w", err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("watch failed: %s", msg.Error.Message)
+		}
+		if msg.Result.Canceled {
+			return errors.New("watch canceled")
+		}
+		if len(msg.Result.Events) == 0 {
+			continue
+		}
+
+		targets, _, err := e.Load(ctx)
+		if err != nil {
+			return err
+		}
+		e.update(pool, targets)
+	}
+}
+
+func (e *Etcd) update(pool *services.Pool, targets []services.Target) {
+	if len(targets) == 0 {
+		slog.Error("etcd discovery found no servers, keeping current servers", "prefix", e.config.Prefix)
+		return
+	}
+	pool.Update(targets)
+}
+
+// Load returns servers stored under the prefix and the store revision they
+// were read at.
+func (e *Etcd) Load(ctx context.Context) ([]services.Target, int64, error) {
+
+	body, err := json.Marshal(map[string]string{
+		"key":       encodeKey(e.config.Prefix),
+		"range_end": encodeKey(prefixEnd(e.config.Prefix)),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := e.post(ctx, "/v3/kv/range", body)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var r etcdRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	revision, err := strconv.ParseInt(r.Header.Revision, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid revision: %w", err)
+	}
+
+	targets := make([]services.Target, 0, len(r.Kvs))
+	for _, kv := range r.Kvs {
+		target, err := e.parseValue(kv.Value)
+		if err != nil {
+			key, _ := base64.StdEncoding.DecodeString(kv.Key)
+			slog.Error("etcd discovery skipped invalid key", "key", string(key), "error", err)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Address < targets[j].Address })
+
+	return targets, revision, nil
+}
+
+func (e *Etcd) parseValue(encoded string) (services.Target, error) {
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return services.Target{}, err
+	}
+
+	value := etcdValue{}
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &value); err != nil {
+			return services.Target{}, err
+		}
+	} else {
+		value.Address = string(trimmed)
+	}
+
+	if value.Address == "" {
+		return services.Target{}, errors.New("empty address")
+	}
+	if value.Weight < 0 {
+		return services.Target{}, errors.New("negative weight")
+	}
+	if value.HealthPath == "" {
+		value.HealthPath = e.config.HealthPath
+	}
+
+	return services.Target{
+		Address:    value.Address,
+		HealthPath: value.HealthPath,
+		Weight:     value.Weight,
+		Labels:     value.Labels,
+	}, nil
+}
+
+func (e *Etcd) post(ctx context.Context, path string, body []byte) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+func encodeKey(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// prefixEnd returns the smallest key greater than every key with the prefix.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
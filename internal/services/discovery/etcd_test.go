@@ -0,0 +1,208 @@
+package discovery_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"test-task/internal/services"
+	"test-task/internal/services/discovery"
+	"testing"
+	"time"
+)
+
+// fakeEtcd implements the parts of the etcd v3 JSON gateway used by the
+// discovery: prefix ranges and a streaming watch.
+type fakeEtcd struct {
+	mu       sync.Mutex
+	revision int64
+	kvs      map[string]string
+	changed  chan struct{}
+}
+
+func newFakeEtcd(t *testing.T) (*fakeEtcd, *httptest.Server) {
+	e := &fakeEtcd{revision: 1, kvs: map[string]string{}, changed: make(chan struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v3/kv/range", e.handleRange)
+	mux.HandleFunc("POST /v3/watch", e.handleWatch)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return e, srv
+}
+
+func (e *fakeEtcd) put(key, value string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.kvs[key] = value
+	e.revision++
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+func (e *fakeEtcd) delete(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.kvs, key)
+	e.revision++
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+func decodeKey(s string) string {
+	b, _ := base64.StdEncoding.DecodeString(s)
+	return string(b)
+}
+
+func (e *fakeEtcd) handleRange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key      string `json:"key"`
+		RangeEnd string `json:"range_end"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, end := decodeKey(req.Key), decodeKey(req.RangeEnd)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var keys []string
+	for k := range e.kvs {
+		if k >= start && k < end {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	kvs := make([]map[string]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, map[string]string{
+			"key":   base64.StdEncoding.EncodeToString([]byte(k)),
+			"value": base64.StdEncoding.EncodeToString([]byte(e.kvs[k])),
+		})
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"header": map[string]string{"revision": strconv.FormatInt(e.revision, 10)},
+		"kvs":    kvs,
+	})
+}
+
+func (e *fakeEtcd) handleWatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CreateRequest struct {
+			StartRevision string `json:"start_revision"`
+		} `json:"create_request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	next, _ := strconv.ParseInt(req.CreateRequest.StartRevision, 10, 64)
+
+	flusher := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	_ = encoder.Encode(map[string]any{"result": map[string]any{"created": true}})
+	flusher.Flush()
+
+	for {
+		e.mu.Lock()
+		revision, changed := e.revision, e.changed
+		e.mu.Unlock()
+
+		// changes made since start_revision are replayed right away
+		if revision < next {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			continue
+		}
+		next = revision + 1
+
+		_ = encoder.Encode(map[string]any{"result": map[string]any{"events": []map[string]any{{"type": "PUT"}}}})
+		flusher.Flush()
+	}
+}
+
+func TestEtcd_Load(t *testing.T) {
+	fake, srv := newFakeEtcd(t)
+	fake.put("/services/web/1", "http://10.0.0.1:8080")
+	fake.put("/services/web/2", `{"address": "http://10.0.0.2:8080", "weight": 2, "labels": {"zone": "b"}, "health_path": "/ready"}`)
+	fake.put("/services/web/3", `{"weight": 2}`)
+	fake.put("/services/other/1", "http://10.0.0.9:8080")
+
+	e, err := discovery.NewEtcd(discovery.EtcdConfig{
+		Endpoint:      srv.URL,
+		Prefix:        "/services/web/",
+		HealthPath:    "/health",
+		RetryInterval: time.Second,
+	})
+	require.NoError(t, err)
+
+	targets, revision, err := e.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), revision)
+	assert.Equal(t, []services.Target{
+		{Address: "http://10.0.0.1:8080", HealthPath: "/health"},
+		{Address: "http://10.0.0.2:8080", HealthPath: "/ready", Weight: 2, Labels: map[string]string{"zone": "b"}},
+	}, targets)
+}
+
+func TestEtcd_WatchUpdatesPool(t *testing.T) {
+	fake, srv := newFakeEtcd(t)
+	fake.put("/services/web/1", "http://10.0.0.1:8080")
+	fake.put("/services/web/2", "http://10.0.0.2:8080")
+
+	e, err := discovery.NewEtcd(discovery.EtcdConfig{
+		Endpoint:      srv.URL,
+		Prefix:        "/services/web/",
+		RetryInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	pool := services.NewPool(nil)
+	updates := make(chan []*services.ServerInfo, 10)
+	pool.OnChange(func(servers []*services.ServerInfo) { updates <- servers })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go e.Run(ctx, pool)
+	defer func() {
+		cancel()
+		e.WaitForStop()
+	}()
+
+	first := waitForUpdate(t, updates)
+	require.Len(t, first, 2)
+	first[0].IncConnections()
+
+	fake.delete("/services/web/2")
+	fake.put("/services/web/3", "http://10.0.0.3:8080")
+
+	var addresses []string
+	assert.Eventually(t, func() bool {
+		servers := pool.Servers()
+		addresses = addresses[:0]
+		for _, s := range servers {
+			addresses = append(addresses, s.Address())
+		}
+		return strings.Join(addresses, ",") == "http://10.0.0.1:8080,http://10.0.0.3:8080"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Same(t, first[0], pool.Servers()[0])
+	assert.Equal(t, int32(1), pool.Servers()[0].Connections())
+}
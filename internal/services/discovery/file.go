@@ -0,0 +1,156 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"test-task/internal/services"
+	"time"
+)
+
+type FileConfig struct {
+	Path       string        `validate:"required"`
+	HealthPath string        // used for groups that don't set their own
+	Debounce   time.Duration `validate:"gt=0"`
+}
+
+// targetGroup follows the Prometheus file_sd format with optional weight,
+// priority and health path. The file may be written as JSON or YAML.
+type targetGroup struct {
+	Targets    []string          `yaml:"targets" validate:"required,dive,required"`
+	Labels     map[string]string `yaml:"labels"`
+	Weight     int               `yaml:"weight" validate:"gte=0"`
+	Priority   int               `yaml:"priority" validate:"gte=0"`
+	Backup     bool              `yaml:"backup"`
+	HealthPath string            `yaml:"health_path"`
+}
+
+// File watches a file listing backends and updates the server pool whenever
+// the file changes. Invalid files are rejected and the current pool is kept.
+type File struct {
+	config FileConfig
+	done   chan struct{}
+}
+
+var _ services.Discovery = (*File)(nil)
+
+func NewFile(config FileConfig) (*File, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &File{config: config, done: make(chan struct{}, 1)}, nil
+}
+
+func (f *File) Run(ctx context.Context, pool *services.Pool) {
+
+	defer func() { f.done <- struct{}{} }()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("file discovery failed to start watcher", "error", err)
+		return
+	}
+	defer watcher.Close()
+
+	// The directory is watched instead of the file itself so that atomic
+	// replacements via rename are noticed as well.
+	if err := watcher.Add(filepath.Dir(f.config.Path)); err != nil {
+		slog.Error("file discovery failed to watch directory", "path", f.config.Path, "error", err)
+		return
+	}
+
+	f.refresh(pool)
+
+	debounce := time.NewTimer(f.config.Debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("file discovery stopped")
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(f.config.Path) {
+				debounce.Reset(f.config.Debounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("file discovery watcher error", "error", err)
+
+		case <-debounce.C:
+			f.refresh(pool)
+		}
+	}
+}
+
+func (f *File) WaitForStop() {
+	<-f.done
+}
+
+func (f *File) refresh(pool *services.Pool) {
+	targets, err := f.Load()
+	if err != nil {
+		slog.Error("file discovery failed, keeping current servers", "path", f.config.Path, "error", err)
+		return
+	}
+	pool.Update(targets)
+}
+
+func (f *File) Load() ([]services.Target, error) {
+
+	data, err := os.ReadFile(f.config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []targetGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse file: %w", err)
+	}
+
+	validate := validator.New()
+	var targets []services.Target
+	for i, group := range groups {
+		if err := validate.Struct(group); err != nil {
+			return nil, fmt.Errorf("invalid group %d: %w", i, err)
+		}
+
+		healthPath := group.HealthPath
+		if healthPath == "" {
+			healthPath = f.config.HealthPath
+		}
+
+		for _, address := range group.Targets {
+			targets = append(targets, services.Target{
+				Address:    address,
+				HealthPath: healthPath,
+				Weight:     group.Weight,
+				Labels:     group.Labels,
+				Priority:   group.Priority,
+				Backup:     group.Backup,
+			})
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("no targets found")
+	}
+	return targets, nil
+}
@@ -0,0 +1,103 @@
+package discovery_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"test-task/internal/services"
+	"test-task/internal/services/discovery"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte(content), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+func waitForUpdate(t *testing.T, updates chan []*services.ServerInfo) []*services.ServerInfo {
+	select {
+	case servers := <-updates:
+		return servers
+	case <-time.After(2 * time.Second):
+		t.Fatal("pool was not updated")
+		return nil
+	}
+}
+
+func TestFile_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	writeFile(t, path, `[
+		{"targets": ["http://10.0.0.1:8080", "http://10.0.0.2:8080"], "labels": {"zone": "a"}, "weight": 2},
+		{"targets": ["http://10.0.0.3:8080"], "health_path": "/ready"}
+	]`)
+
+	f, err := discovery.NewFile(discovery.FileConfig{Path: path, HealthPath: "/health", Debounce: time.Millisecond})
+	require.NoError(t, err)
+
+	targets, err := f.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []services.Target{
+		{Address: "http://10.0.0.1:8080", HealthPath: "/health", Weight: 2, Labels: map[string]string{"zone": "a"}},
+		{Address: "http://10.0.0.2:8080", HealthPath: "/health", Weight: 2, Labels: map[string]string{"zone": "a"}},
+		{Address: "http://10.0.0.3:8080", HealthPath: "/ready"},
+	}, targets)
+}
+
+func TestFile_LoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+
+	f, err := discovery.NewFile(discovery.FileConfig{Path: path, Debounce: time.Millisecond})
+	require.NoError(t, err)
+
+	for _, content := range []string{
+		"not: [a list",
+		"- targets: []",
+		"- targets: ['http://10.0.0.1:8080']\n  weight: -1",
+		"[]",
+	} {
+		writeFile(t, path, content)
+		_, err := f.Load()
+		assert.Error(t, err, content)
+	}
+}
+
+func TestFile_WatchUpdatesPool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	writeFile(t, path, "- targets: ['http://10.0.0.1:8080', 'http://10.0.0.2:8080']\n")
+
+	f, err := discovery.NewFile(discovery.FileConfig{Path: path, HealthPath: "/health", Debounce: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	pool := services.NewPool(nil)
+	updates := make(chan []*services.ServerInfo, 10)
+	pool.OnChange(func(servers []*services.ServerInfo) { updates <- servers })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go f.Run(ctx, pool)
+	defer func() {
+		cancel()
+		f.WaitForStop()
+	}()
+
+	first := waitForUpdate(t, updates)
+	require.Len(t, first, 2)
+	first[0].IncConnections()
+
+	// an invalid file must not touch the pool
+	writeFile(t, path, "- targets: [")
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, first, pool.Servers())
+
+	writeFile(t, path, "- targets: ['http://10.0.0.1:8080']\n  weight: 5\n  labels: {zone: b}\n")
+
+	second := waitForUpdate(t, updates)
+	require.Len(t, second, 1)
+	assert.Same(t, first[0], second[0])
+	assert.Equal(t, int32(1), second[0].Connections())
+	assert.Equal(t, 5, second[0].Weight())
+	assert.Equal(t, "b", second[0].Label("zone"))
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	// EventHealthChanged is published when a health check changes the state
+	// of a server.
+	EventHealthChanged EventType = "health_changed"
+	// EventEjected is published when a server is taken out of rotation
+	// because of failed requests, before the health check confirms it.
+	EventEjected EventType = "ejected"
+	EventAdded   EventType = "added"
+	EventRemoved EventType = "removed"
+	// EventDrained follows EventRemoved once the last request to the removed
+	// server has finished.
+	EventDrained EventType = "drained"
+)
+
+type Event struct {
+	Type    EventType `json:"type"`
+	Server  string    `json:"server"`
+	Healthy bool      `json:"healthy"`
+	Reason  string    `json:"reason,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// EventBus delivers server events to its subscribers synchronously, so a
+// subscriber must not block. A nil bus drops all events.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers []func(Event)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+func (b *EventBus) Subscribe(subscriber func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+func (b *EventBus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(event)
+	}
+}
+
+// LogEvent is a subscriber writing events to the structured log.
+func LogEvent(event Event) {
+	level := slog.LevelInfo
+	if event.Type == EventEjected || (event.Type == EventHealthChanged && !event.Healthy) {
+		level = slog.LevelWarn
+	}
+
+	attrs := []any{"type", event.Type, "address", event.Server, "healthy", event.Healthy}
+	if event.Reason != "" {
+		attrs = append(attrs, "reason", event.Reason)
+	}
+	slog.Log(context.Background(), level, "server event", attrs...)
+}
@@ -0,0 +1,103 @@
+package services_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"test-task/internal/services"
+	"testing"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []services.Event
+}
+
+func (r *eventRecorder) record(event services.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []services.EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	types := make([]services.EventType, len(r.events))
+	for i, e := range r.events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func newRecordedBus() (*services.EventBus, *eventRecorder) {
+	bus := services.NewEventBus()
+	recorder := &eventRecorder{}
+	bus.Subscribe(recorder.record)
+	return bus, recorder
+}
+
+func TestServerInfo_HealthEvents(t *testing.T) {
+	bus, recorder := newRecordedBus()
+	server := services.NewServerInfo("http://a", "/health")
+	server.SetEvents(bus)
+
+	server.SetHealthy(true)
+	server.SetHealthy(true)
+	server.Eject("proxy error")
+	server.Eject("proxy error")
+	server.SetHealthy(false)
+	server.SetHealthy(true)
+
+	assert.Equal(t, []services.EventType{
+		services.EventHealthChanged,
+		services.EventEjected,
+		services.EventHealthChanged,
+	}, recorder.types())
+
+	ejected := recorder.events[1]
+	assert.Equal(t, "http://a", ejected.Server)
+	assert.False(t, ejected.Healthy)
+	assert.Equal(t, "proxy error", ejected.Reason)
+	assert.False(t, ejected.Time.IsZero())
+	assert.True(t, recorder.events[2].Healthy)
+}
+
+func TestServerInfo_NoBus(t *testing.T) {
+	server := services.NewServerInfo("http://a", "/health")
+	server.SetHealthy(true)
+	server.Eject("proxy error")
+	assert.False(t, server.IsHealthy())
+}
+
+func TestPool_Events(t *testing.T) {
+	bus, recorder := newRecordedBus()
+	pool := services.NewPool(nil)
+	pool.SetEvents(bus)
+
+	pool.Update([]services.Target{{Address: "a"}, {Address: "b"}})
+	assert.Equal(t, []services.EventType{services.EventAdded, services.EventAdded}, recorder.types())
+
+	// servers added by the pool publish their own events
+	servers := pool.Servers()
+	servers[0].SetHealthy(true)
+	require.Len(t, recorder.types(), 3)
+	assert.Equal(t, services.EventHealthChanged, recorder.types()[2])
+
+	busy, idle := servers[0], servers[1]
+	busy.IncConnections()
+	recorder.events = nil
+	pool.Update(nil)
+	assert.ElementsMatch(t, []services.EventType{
+		services.EventRemoved, services.EventRemoved, services.EventDrained,
+	}, recorder.types())
+	assert.Equal(t, idle.Address(), recorder.events[len(recorder.events)-1].Server)
+
+	busy.DecConnections()
+	assert.Equal(t, services.EventDrained, recorder.types()[3])
+	assert.Equal(t, busy.Address(), recorder.events[3].Server)
+
+	busy.IncConnections()
+	busy.DecConnections()
+	assert.Len(t, recorder.types(), 4)
+}
@@ -3,62 +3,109 @@ package services
 import (
 	"context"
 	"log/slog"
-	"net/http"
+	"math/rand/v2"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
+type HealthCheckConfig struct {
+	// Interval between probes of a healthy server, unless the server sets its
+	// own.
+	Interval time.Duration
+	// UnhealthyInterval re-checks unhealthy servers sooner so they are
+	// re-admitted quickly. Zero uses the healthy interval.
+	UnhealthyInterval time.Duration
+	// Jitter randomly shifts every interval by up to this fraction, so
+	// servers are not probed in lockstep. It is capped at maxJitter.
+	Jitter float64
+	// MaxConcurrent limits probes running at the same time, zero means no
+	// limit.
+	MaxConcurrent int
+}
+
+// maxJitter keeps a jittered interval at half of the configured one or more,
+// so the probe loop never spins.
+const maxJitter = 0.5
+
+// HealthChecker probes every server on its own schedule. Each server is
+// probed as soon as it is added, and is considered unhealthy until then.
 type HealthChecker struct {
-	servers             []*ServerInfo
-	healthCheckTimeout  time.Duration
-	healthCheckInterval time.Duration
-	healthTicker        *time.Ticker
-	done                chan struct{}
+	mu      sync.Mutex
+	servers []*ServerInfo
+	prober  Prober
+	config  HealthCheckConfig
+	slots   chan struct{}
+
+	ctx     context.Context
+	loops   map[*ServerInfo]context.CancelFunc
+	wg      sync.WaitGroup
+	initial sync.WaitGroup
+	ready   chan struct{}
+	done    chan struct{}
 }
 
-func NewHealthChecker(servers []*ServerInfo, healthCheckInterval time.Duration, healthCheckTimeout time.Duration) *HealthChecker {
-	return &HealthChecker{
-		servers:             servers,
-		healthCheckInterval: healthCheckInterval,
-		healthCheckTimeout:  healthCheckTimeout,
-		done:                make(chan struct{}, 1),
+func NewHealthChecker(servers []*ServerInfo, prober Prober, config HealthCheckConfig) *HealthChecker {
+	h := &HealthChecker{
+		servers: servers,
+		prober:  prober,
+		config:  config,
+		loops:   make(map[*ServerInfo]context.CancelFunc),
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}, 1),
+	}
+	if config.MaxConcurrent > 0 {
+		h.slots = make(chan struct{}, config.MaxConcurrent)
 	}
+	return h
 }
 
 func (h *HealthChecker) Run(ctx context.Context) {
 
-	h.healthTicker = time.NewTicker(h.healthCheckInterval)
-	client := http.Client{Timeout: h.healthCheckTimeout}
+	h.mu.Lock()
+	h.ctx = ctx
+	h.initial.Add(len(h.servers))
+	for _, server := range h.servers {
+		h.start(server, h.initial.Done)
+	}
+	h.mu.Unlock()
 
-	for {
-		select {
-		case <-ctx.Done():
-			slog.Info("health check stopped")
-			h.done <- struct{}{}
-			return
+	go func() {
+		h.initial.Wait()
+		slog.Info("initial health check finished")
+		close(h.ready)
+	}()
 
-		case <-h.healthTicker.C:
-			var failed atomic.Int32
-			var wg sync.WaitGroup
-
-			slog.Info("health check started")
-			for i := range h.servers {
-				wg.Add(1)
-				go func(s *ServerInfo) {
-					defer wg.Done()
-					healthy := checkHealth(client, s)
-					s.SetHealthy(healthy)
-					if !healthy {
-						failed.Add(1)
-					}
-				}(h.servers[i])
-			}
+	<-ctx.Done()
+	h.wg.Wait()
+	slog.Info("health check stopped")
+	h.done <- struct{}{}
+}
 
-			wg.Wait()
-			slog.Info("health check finished",
-				"healthy", len(h.servers)-int(failed.Load()),
-				"unhealthy", failed.Load())
+// Ready is closed once the servers known at startup have been probed.
+func (h *HealthChecker) Ready() <-chan struct{} {
+	return h.ready
+}
+
+func (h *HealthChecker) SetServers(servers []*ServerInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.servers = servers
+	if h.ctx == nil || h.ctx.Err() != nil {
+		return
+	}
+
+	current := make(map[*ServerInfo]struct{}, len(servers))
+	for _, server := range servers {
+		current[server] = struct{}{}
+		if _, ok := h.loops[server]; !ok {
+			h.start(server, func() {})
+		}
+	}
+	for server, cancel := range h.loops {
+		if _, ok := current[server]; !ok {
+			cancel()
+			delete(h.loops, server)
 		}
 	}
 }
@@ -67,18 +114,84 @@ func (h *HealthChecker) WaitForStop() {
 	<-h.done
 }
 
-func checkHealth(client http.Client, server *ServerInfo) bool {
-	resp, err := client.Get(server.HealthCheckAddress())
-	if err != nil {
+func (h *HealthChecker) start(server *ServerInfo, probed func()) {
+	ctx, cancel := context.WithCancel(h.ctx)
+	h.loops[server] = cancel
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.loop(ctx, server, probed)
+	}()
+}
+
+func (h *HealthChecker) loop(ctx context.Context, server *ServerInfo, probed func()) {
+
+	first := true
+	for {
+		if !h.acquire(ctx) {
+			if first {
+				probed()
+			}
+			return
+		}
+		h.probe(server)
+		h.release()
+
+		if first {
+			first = false
+			probed()
+		}
+
+		timer := time.NewTimer(h.nextInterval(server))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (h *HealthChecker) probe(server *ServerInfo) {
+	if err := h.prober.Probe(server); err != nil {
 		slog.Info("health check failed", "path", server.HealthCheckAddress(), "error", err)
-		return false
+		server.setHealthy(false, err.Error())
+		return
+	}
+	server.setHealthy(true, "")
+}
+
+func (h *HealthChecker) nextInterval(server *ServerInfo) time.Duration {
+	interval := h.config.Interval
+	if server.HealthCheckInterval() > 0 {
+		interval = server.HealthCheckInterval()
+	}
+	if !server.IsHealthy() && h.config.UnhealthyInterval > 0 && h.config.UnhealthyInterval < interval {
+		interval = h.config.UnhealthyInterval
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		slog.Info("health check failed", "path", server.HealthCheckAddress(), "status", resp.Status)
+	if h.config.Jitter > 0 {
+		shift := (rand.Float64()*2 - 1) * min(h.config.Jitter, maxJitter)
+		interval += time.Duration(float64(interval) * shift)
+	}
+	return interval
+}
+
+func (h *HealthChecker) acquire(ctx context.Context) bool {
+	if h.slots == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case h.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
 		return false
 	}
+}
 
-	return true
+func (h *HealthChecker) release() {
+	if h.slots != nil {
+		<-h.slots
+	}
 }
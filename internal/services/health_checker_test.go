@@ -0,0 +1,178 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"test-task/internal/services"
+	"testing"
+	"time"
+)
+
+type fakeProber struct {
+	mu       sync.Mutex
+	failing  map[string]bool
+	probes   map[string]int
+	running  atomic.Int32
+	maxSeen  atomic.Int32
+	duration time.Duration
+}
+
+func newFakeProber() *fakeProber {
+	return &fakeProber{failing: make(map[string]bool), probes: make(map[string]int)}
+}
+
+func (p *fakeProber) Probe(server *services.ServerInfo) error {
+	running := p.running.Add(1)
+	defer p.running.Add(-1)
+	for {
+		seen := p.maxSeen.Load()
+		if running <= seen || p.maxSeen.CompareAndSwap(seen, running) {
+			break
+		}
+	}
+	time.Sleep(p.duration)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.probes[server.Address()]++
+	if p.failing[server.Address()] {
+		return errors.New("unhealthy")
+	}
+	return nil
+}
+
+func (p *fakeProber) setFailing(address string, failing bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failing[address] = failing
+}
+
+func (p *fakeProber) count(address string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.probes[address]
+}
+
+func runChecker(t *testing.T, checker *services.HealthChecker) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go checker.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		checker.WaitForStop()
+	})
+}
+
+func TestHealthChecker_InitialProbe(t *testing.T) {
+	prober := newFakeProber()
+	prober.setFailing("b", true)
+	servers := []*services.ServerInfo{
+		services.NewServerInfo("a", "/health"),
+		services.NewServerInfo("b", "/health"),
+	}
+	assert.False(t, servers[0].IsHealthy())
+
+	checker := services.NewHealthChecker(servers, prober, services.HealthCheckConfig{Interval: time.Hour})
+	runChecker(t, checker)
+
+	select {
+	case <-checker.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("initial probe did not finish")
+	}
+	assert.True(t, servers[0].IsHealthy())
+	assert.False(t, servers[1].IsHealthy())
+}
+
+func TestHealthChecker_UnhealthyInterval(t *testing.T) {
+	prober := newFakeProber()
+	prober.setFailing("a", true)
+	server := services.NewServerInfo("a", "/health")
+
+	checker := services.NewHealthChecker([]*services.ServerInfo{server}, prober, services.HealthCheckConfig{
+		Interval:          time.Hour,
+		UnhealthyInterval: 10 * time.Millisecond,
+		Jitter:            0.5,
+	})
+	runChecker(t, checker)
+	<-checker.Ready()
+	require.False(t, server.IsHealthy())
+
+	prober.setFailing("a", false)
+	require.Eventually(t, server.IsHealthy, time.Second, 5*time.Millisecond)
+
+	// healthy again, back to the long interval
+	probes := prober.count("a")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, probes, prober.count("a"))
+}
+
+func TestHealthChecker_PerServerInterval(t *testing.T) {
+	prober := newFakeProber()
+	fast := services.NewServerInfo("fast", "/health")
+	fast.SetHealthCheckInterval(10 * time.Millisecond)
+	slow := services.NewServerInfo("slow", "/health")
+
+	checker := services.NewHealthChecker([]*services.ServerInfo{fast, slow}, prober, services.HealthCheckConfig{Interval: time.Hour})
+	runChecker(t, checker)
+
+	require.Eventually(t, func() bool { return prober.count("fast") >= 3 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, prober.count("slow"))
+}
+
+func TestHealthChecker_MaxConcurrent(t *testing.T) {
+	prober := newFakeProber()
+	prober.duration = 20 * time.Millisecond
+
+	var servers []*services.ServerInfo
+	for _, address := range []string{"a", "b", "c", "d", "e", "f"} {
+		servers = append(servers, services.NewServerInfo(address, "/health"))
+	}
+
+	checker := services.NewHealthChecker(servers, prober, services.HealthCheckConfig{Interval: time.Hour, MaxConcurrent: 2})
+	runChecker(t, checker)
+	<-checker.Ready()
+
+	assert.Equal(t, int32(2), prober.maxSeen.Load())
+}
+
+func TestHealthChecker_SetServers(t *testing.T) {
+	prober := newFakeProber()
+	checker := services.NewHealthChecker(nil, prober, services.HealthCheckConfig{Interval: time.Hour})
+	runChecker(t, checker)
+	<-checker.Ready()
+
+	added := services.NewServerInfo("added", "/health")
+	checker.SetServers([]*services.ServerInfo{added})
+	require.Eventually(t, added.IsHealthy, time.Second, 5*time.Millisecond)
+}
+
+func TestHealthChecker_JitterIsCapped(t *testing.T) {
+	prober := newFakeProber()
+	server := services.NewServerInfo("a", "/health")
+
+	checker := services.NewHealthChecker([]*services.ServerInfo{server}, prober, services.HealthCheckConfig{
+		Interval: 20 * time.Millisecond,
+		Jitter:   1,
+	})
+	runChecker(t, checker)
+	time.Sleep(200 * time.Millisecond)
+
+	// intervals never drop below 10ms
+	assert.LessOrEqual(t, prober.count("a"), 21)
+}
+
+func TestHealthChecker_ServersSetBeforeRun(t *testing.T) {
+	prober := newFakeProber()
+	checker := services.NewHealthChecker(nil, prober, services.HealthCheckConfig{Interval: time.Hour})
+
+	discovered := services.NewServerInfo("discovered", "/health")
+	checker.SetServers([]*services.ServerInfo{discovered})
+	runChecker(t, checker)
+
+	<-checker.Ready()
+	assert.True(t, discovered.IsHealthy())
+}
@@ -2,19 +2,53 @@ package services
 
 import (
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"test-task/internal/backendurl"
+	"time"
 )
 
+const DefaultWeight = 1
+
+// ZoneLabel holds the availability zone of a server.
+const ZoneLabel = "zone"
+
 type ServerInfo struct {
 	address        string
+	url            *url.URL
 	healthPath     string
+	handlers       sync.Map
+	weight         atomic.Int32
+	labels         atomic.Pointer[map[string]string]
+	priority       atomic.Int32
+	backup         atomic.Bool
+	checkInterval  atomic.Int64
 	healthy        atomic.Bool
 	activeRequests atomic.Int32
+	bytesSent      atomic.Int64
+	bytesReceived  atomic.Int64
+	events         atomic.Pointer[EventBus]
+	draining       atomic.Bool
+	drained        atomic.Bool
+	requests       requestStats
 }
 
+// NewServerInfo returns an unhealthy server, it gets traffic once the first
+// health check passes. An http address that fails to parse is logged, the
+// server is kept so that its requests fail with 502.
 func NewServerInfo(address string, healthPath string) *ServerInfo {
 	s := &ServerInfo{address: address, healthPath: healthPath}
-	s.SetHealthy(true)
+	if strings.Contains(address, "://") {
+		u, err := backendurl.Parse(address)
+		if err != nil {
+			slog.Warn("invalid server address", "address", address, "error", err)
+		}
+		s.url = u
+	}
+	s.SetWeight(DefaultWeight)
 	return s
 }
 
@@ -22,8 +56,105 @@ func (s *ServerInfo) Address() string {
 	return s.address
 }
 
+// URL is the address of an http backend parsed once, nil for host:port
+// addresses of tcp backends and for addresses backendurl.Parse rejects.
+func (s *ServerInfo) URL() *url.URL {
+	return s.url
+}
+
 func (s *ServerInfo) HealthCheckAddress() string {
-	return s.address + s.healthPath
+	if s.url == nil {
+		return s.address + s.healthPath
+	}
+	ref, err := url.Parse(s.healthPath)
+	if err != nil {
+		return s.address + s.healthPath
+	}
+	u := *s.url
+	u.Path, u.RawPath = backendurl.JoinPath(s.url, ref)
+	u.RawQuery = ref.RawQuery
+	return u.String()
+}
+
+// HandlerFactory builds the handler a transport uses to reach a server.
+type HandlerFactory interface {
+	NewHandler(server *ServerInfo) http.Handler
+}
+
+// Handler returns the handler built by factory for this server, building it
+// on first use. Transports keep their reverse proxies here, so they go away
+// together with the server.
+func (s *ServerInfo) Handler(factory HandlerFactory) http.Handler {
+	if handler, ok := s.handlers.Load(factory); ok {
+		return handler.(http.Handler)
+	}
+	handler, _ := s.handlers.LoadOrStore(factory, factory.NewHandler(s))
+	return handler.(http.Handler)
+}
+
+func (s *ServerInfo) Weight() int {
+	return int(s.weight.Load())
+}
+
+// SetWeight sets the relative share of traffic for weighted balancing.
+// Non-positive values fall back to DefaultWeight.
+func (s *ServerInfo) SetWeight(weight int) {
+	if weight <= 0 {
+		weight = DefaultWeight
+	}
+	s.weight.Store(int32(weight))
+}
+
+func (s *ServerInfo) Labels() map[string]string {
+	labels := s.labels.Load()
+	if labels == nil {
+		return nil
+	}
+	return *labels
+}
+
+func (s *ServerInfo) Label(name string) string {
+	return s.Labels()[name]
+}
+
+// SetLabels replaces the server labels. The map must not be modified after
+// the call.
+func (s *ServerInfo) SetLabels(labels map[string]string) {
+	s.labels.Store(&labels)
+}
+
+func (s *ServerInfo) Zone() string {
+	return s.Label(ZoneLabel)
+}
+
+// Priority orders groups of servers, 0 is the most preferred. Servers of a
+// lower priority only get traffic when the preferred ones fail.
+func (s *ServerInfo) Priority() int {
+	return int(s.priority.Load())
+}
+
+func (s *ServerInfo) SetPriority(priority int) {
+	s.priority.Store(int32(priority))
+}
+
+// IsBackup reports whether the server is only used after all priorities of
+// regular servers have failed.
+func (s *ServerInfo) IsBackup() bool {
+	return s.backup.Load()
+}
+
+func (s *ServerInfo) SetBackup(value bool) {
+	s.backup.Store(value)
+}
+
+// HealthCheckInterval overrides the checker's interval for this server, zero
+// means the default.
+func (s *ServerInfo) HealthCheckInterval() time.Duration {
+	return time.Duration(s.checkInterval.Load())
+}
+
+func (s *ServerInfo) SetHealthCheckInterval(interval time.Duration) {
+	s.checkInterval.Store(int64(interval))
 }
 
 func (s *ServerInfo) IsHealthy() bool {
@@ -31,7 +162,51 @@ func (s *ServerInfo) IsHealthy() bool {
 }
 
 func (s *ServerInfo) SetHealthy(value bool) {
-	s.healthy.Store(value)
+	s.setHealthy(value, "")
+}
+
+func (s *ServerInfo) setHealthy(value bool, reason string) {
+	if s.healthy.Swap(value) != value {
+		s.publish(EventHealthChanged, reason)
+	}
+}
+
+// Eject takes a server out of rotation after a failed request, the health
+// check brings it back once it recovers.
+func (s *ServerInfo) Eject(reason string) {
+	if s.healthy.Swap(false) {
+		s.publish(EventEjected, reason)
+	}
+}
+
+// SetEvents sets the bus the server publishes its events to.
+func (s *ServerInfo) SetEvents(events *EventBus) {
+	s.events.Store(events)
+}
+
+func (s *ServerInfo) publish(eventType EventType, reason string) {
+	s.events.Load().Publish(Event{
+		Type:    eventType,
+		Server:  s.address,
+		Healthy: s.IsHealthy(),
+		Reason:  reason,
+	})
+}
+
+// drain marks a server removed from the pool, EventDrained is published when
+// its last request finishes.
+func (s *ServerInfo) drain() {
+	s.draining.Store(true)
+	s.publish(EventRemoved, "")
+	if s.Connections() == 0 {
+		s.drainFinished()
+	}
+}
+
+func (s *ServerInfo) drainFinished() {
+	if s.drained.CompareAndSwap(false, true) {
+		s.publish(EventDrained, "")
+	}
 }
 
 func (s *ServerInfo) IncConnections() {
@@ -42,8 +217,45 @@ func (s *ServerInfo) IncConnections() {
 func (s *ServerInfo) DecConnections() {
 	value := s.activeRequests.Add(-1)
 	slog.Debug("decremented active requests", "address", s.address, "count", value)
+	if value == 0 && s.draining.Load() {
+		s.drainFinished()
+	}
 }
 
 func (s *ServerInfo) Connections() int32 {
 	return s.activeRequests.Load()
 }
+
+func (s *ServerInfo) AddBytesSent(n int64) {
+	s.bytesSent.Add(n)
+}
+
+func (s *ServerInfo) AddBytesReceived(n int64) {
+	s.bytesReceived.Add(n)
+}
+
+func (s *ServerInfo) BytesSent() int64 {
+	return s.bytesSent.Load()
+}
+
+func (s *ServerInfo) BytesReceived() int64 {
+	return s.bytesReceived.Load()
+}
+
+// ObserveRequest records a finished request for the recent error rate and
+// latency.
+func (s *ServerInfo) ObserveRequest(duration time.Duration, failed bool) {
+	s.requests.observe(duration, failed)
+}
+
+func (s *ServerInfo) Stats() ServerStats {
+	stats := ServerStats{
+		Address:       s.address,
+		Healthy:       s.IsHealthy(),
+		Connections:   s.Connections(),
+		BytesSent:     s.BytesSent(),
+		BytesReceived: s.BytesReceived(),
+	}
+	s.requests.fill(&stats)
+	return stats
+}
@@ -0,0 +1,58 @@
+package services_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"test-task/internal/backendurl"
+	"test-task/internal/services"
+	"testing"
+)
+
+func TestServerInfo_URL(t *testing.T) {
+	server := services.NewServerInfo("http://a:8080/api/", "/health?full=1")
+	require.NotNil(t, server.URL())
+	assert.Equal(t, "a:8080", server.URL().Host)
+	assert.Equal(t, "http://a:8080/api/health?full=1", server.HealthCheckAddress())
+
+	assert.Nil(t, services.NewServerInfo("a:8080", "").URL())
+	assert.Nil(t, services.NewServerInfo("ftp://a", "/health").URL())
+}
+
+type countingFactory struct{ built int }
+
+func (f *countingFactory) NewHandler(*services.ServerInfo) http.Handler {
+	f.built++
+	return http.NotFoundHandler()
+}
+
+func TestServerInfo_Handler(t *testing.T) {
+	a, b := services.NewServerInfo("http://a", "/health"), services.NewServerInfo("http://b", "/health")
+	first, second := &countingFactory{}, &countingFactory{}
+
+	handler := a.Handler(first)
+	assert.NotNil(t, handler)
+	a.Handler(first)
+	b.Handler(first)
+	a.Handler(second)
+
+	assert.Equal(t, 2, first.built)
+	assert.Equal(t, 1, second.built)
+}
+
+func TestPool_SkipsInvalidAddresses(t *testing.T) {
+	pool := services.NewPool(nil)
+	pool.SetAddressCheck(func(address string) error {
+		_, err := backendurl.Parse(address)
+		return err
+	})
+	pool.Update([]services.Target{
+		{Address: "http://a:8080", HealthPath: "/health"},
+		{Address: "http://a:99999", HealthPath: "/health"},
+		{Address: "a:8080", HealthPath: "/health"},
+	})
+
+	servers := pool.Servers()
+	require.Len(t, servers, 1)
+	assert.Equal(t, "http://a:8080", servers[0].Address())
+}
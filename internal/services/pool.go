@@ -0,0 +1,180 @@
+package services
+
+import (
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+type Target struct {
+	Address    string
+	HealthPath string
+	Weight     int
+	Labels     map[string]string
+	Priority   int
+	Backup     bool
+	// HealthCheckInterval overrides the checker's interval, zero keeps it.
+	HealthCheckInterval time.Duration
+}
+
+// NewTargetServer returns a new server described by t that publishes its
+// events to the bus, the configured and the discovered servers are built
+// the same way.
+func NewTargetServer(t Target, events *EventBus) *ServerInfo {
+	s := NewServerInfo(t.Address, t.HealthPath)
+	t.apply(s)
+	s.SetEvents(events)
+	return s
+}
+
+// Pool holds the current server list. Updates are diffed by address, so the
+// ServerInfo of a server that stays in the pool keeps its connection count
+// and health state.
+type Pool struct {
+	mu        sync.RWMutex
+	servers   []*ServerInfo
+	listeners []func([]*ServerInfo)
+	events    *EventBus
+	check     func(address string) error
+
+	synced     chan struct{}
+	syncedOnce sync.Once
+}
+
+func NewPool(servers []*ServerInfo) *Pool {
+	return &Pool{servers: servers, synced: make(chan struct{})}
+}
+
+// Synced is closed after the first Update, once its listeners have run.
+func (p *Pool) Synced() <-chan struct{} {
+	return p.synced
+}
+
+func (p *Pool) Servers() []*ServerInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	servers := make([]*ServerInfo, len(p.servers))
+	copy(servers, p.servers)
+	return servers
+}
+
+// OnChange registers a listener called with the new server list after every
+// update that adds or removes servers.
+func (p *Pool) OnChange(listener func([]*ServerInfo)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.listeners = append(p.listeners, listener)
+}
+
+// SetEvents sets the bus for added and removed servers, the servers added
+// later publish their own events to it too.
+func (p *Pool) SetEvents(events *EventBus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = events
+}
+
+// SetAddressCheck sets the check for the addresses of new servers, the ones
+// that fail it are logged and left out of the pool.
+func (p *Pool) SetAddressCheck(check func(address string) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.check = check
+}
+
+func (p *Pool) Update(targets []Target) {
+	defer p.syncedOnce.Do(func() { close(p.synced) })
+
+	p.mu.Lock()
+
+	existing := make(map[string]*ServerInfo, len(p.servers))
+	for _, s := range p.servers {
+		existing[s.Address()] = s
+	}
+
+	servers := make([]*ServerInfo, 0, len(targets))
+	seen := make(map[string]struct{}, len(targets))
+	var added, removed []string
+	var addedServers, removedServers []*ServerInfo
+
+	for _, t := range targets {
+		if _, ok := seen[t.Address]; ok {
+			continue
+		}
+		seen[t.Address] = struct{}{}
+
+		if t.Weight <= 0 {
+			t.Weight = DefaultWeight
+		}
+
+		if s, ok := existing[t.Address]; ok {
+			if s.Weight() != t.Weight || !maps.Equal(s.Labels(), t.Labels) ||
+				s.Priority() != t.Priority || s.IsBackup() != t.Backup {
+				slog.Info("server updated",
+					"address", t.Address,
+					"weight", t.Weight,
+					"labels", t.Labels,
+					"priority", t.Priority,
+					"backup", t.Backup,
+				)
+			}
+			t.apply(s)
+			servers = append(servers, s)
+			continue
+		}
+		if p.check != nil {
+			if err := p.check(t.Address); err != nil {
+				slog.Warn("invalid server address", "address", t.Address, "error", err)
+				continue
+			}
+		}
+		s := NewTargetServer(t, p.events)
+		servers = append(servers, s)
+		added = append(added, t.Address)
+		addedServers = append(addedServers, s)
+	}
+
+	for address, s := range existing {
+		if _, ok := seen[address]; !ok {
+			removed = append(removed, address)
+			removedServers = append(removedServers, s)
+		}
+	}
+
+	if len(added) == 0 && len(removed) == 0 {
+		p.mu.Unlock()
+		return
+	}
+
+	p.servers = servers
+	listeners := p.listeners
+	p.mu.Unlock()
+
+	slog.Info("server pool updated", "added", added, "removed", removed, "total", len(servers))
+
+	for _, s := range addedServers {
+		s.publish(EventAdded, "")
+	}
+	for _, s := range removedServers {
+		s.drain()
+	}
+
+	for _, listener := range listeners {
+		snapshot := make([]*ServerInfo, len(servers))
+		copy(snapshot, servers)
+		listener(snapshot)
+	}
+}
+
+func (t Target) apply(s *ServerInfo) {
+	s.SetWeight(t.Weight)
+	s.SetLabels(t.Labels)
+	s.SetPriority(t.Priority)
+	s.SetBackup(t.Backup)
+	s.SetHealthCheckInterval(t.HealthCheckInterval)
+}
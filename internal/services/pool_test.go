@@ -0,0 +1,57 @@
+package services_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"test-task/internal/services"
+	"testing"
+	"time"
+)
+
+func TestPool_Synced(t *testing.T) {
+	pool := services.NewPool(nil)
+	var notified bool
+	pool.OnChange(func([]*services.ServerInfo) { notified = true })
+
+	select {
+	case <-pool.Synced():
+		t.Fatal("synced before the first update")
+	default:
+	}
+
+	pool.Update([]services.Target{{Address: "http://a:8080", HealthPath: "/health"}})
+	<-pool.Synced()
+	assert.True(t, notified)
+
+	// an update without changes still counts
+	empty := services.NewPool(nil)
+	empty.Update(nil)
+	<-empty.Synced()
+}
+
+func TestNewTargetServer(t *testing.T) {
+	events := services.NewEventBus()
+	var published []services.Event
+	events.Subscribe(func(e services.Event) { published = append(published, e) })
+
+	server := services.NewTargetServer(services.Target{
+		Address:             "http://a:8080",
+		HealthPath:          "/health",
+		Weight:              3,
+		Labels:              map[string]string{services.ZoneLabel: "eu-1"},
+		Priority:            1,
+		Backup:              true,
+		HealthCheckInterval: time.Second,
+	}, events)
+
+	assert.Equal(t, "http://a:8080/health", server.HealthCheckAddress())
+	assert.Equal(t, 3, server.Weight())
+	assert.Equal(t, "eu-1", server.Labels()[services.ZoneLabel])
+	assert.Equal(t, 1, server.Priority())
+	assert.True(t, server.IsBackup())
+	assert.Equal(t, time.Second, server.HealthCheckInterval())
+
+	server.Eject("test")
+	assert.Empty(t, published)
+	server.SetHealthy(true)
+	assert.Len(t, published, 1)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+type Prober interface {
+	Probe(server *ServerInfo) error
+}
+
+type HTTPProber struct {
+	client http.Client
+}
+
+func NewHTTPProber(timeout time.Duration) *HTTPProber {
+	return &HTTPProber{client: http.Client{Timeout: timeout}}
+}
+
+func (p *HTTPProber) Probe(server *ServerInfo) error {
+	resp, err := p.client.Get(server.HealthCheckAddress())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+type TCPProber struct {
+	timeout time.Duration
+}
+
+func NewTCPProber(timeout time.Duration) *TCPProber {
+	return &TCPProber{timeout: timeout}
+}
+
+func (p *TCPProber) Probe(server *ServerInfo) error {
+	if server.Address() == "" {
+		return errors.New("empty address")
+	}
+
+	conn, err := net.DialTimeout("tcp", server.Address(), p.timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,14 @@
+// Package servicestest provides servers for the tests of the packages built
+// on services.
+package servicestest
+
+import (
+	"test-task/internal/services"
+)
+
+// HealthyServer returns a server that already passed its first health check.
+func HealthyServer(address, healthPath string) *services.ServerInfo {
+	server := services.NewServerInfo(address, healthPath)
+	server.SetHealthy(true)
+	return server
+}
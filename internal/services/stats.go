@@ -0,0 +1,85 @@
+package services
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// statsWindow is how far back the recent error rate and latency look.
+	statsWindow = time.Minute
+	// maxSamples bounds the memory per server, under heavy load the window
+	// covers the last maxSamples requests only.
+	maxSamples = 1024
+)
+
+type ServerStats struct {
+	Address       string  `json:"address"`
+	Healthy       bool    `json:"healthy"`
+	Connections   int32   `json:"connections"`
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	Requests      int     `json:"requests"`
+	ErrorRate     float64 `json:"error_rate"`
+	P50Ms         float64 `json:"p50_ms"`
+	P90Ms         float64 `json:"p90_ms"`
+	P99Ms         float64 `json:"p99_ms"`
+}
+
+type sample struct {
+	at       time.Time
+	duration time.Duration
+	failed   bool
+}
+
+// requestStats keeps the latest requests in a ring buffer.
+type requestStats struct {
+	mu      sync.Mutex
+	samples [maxSamples]sample
+	next    int
+}
+
+func (s *requestStats) observe(duration time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples[s.next] = sample{at: time.Now(), duration: duration, failed: failed}
+	s.next = (s.next + 1) % maxSamples
+}
+
+func (s *requestStats) fill(stats *ServerStats) {
+	since := time.Now().Add(-statsWindow)
+	durations := make([]time.Duration, 0, maxSamples)
+	failed := 0
+
+	s.mu.Lock()
+	for _, sample := range s.samples {
+		if sample.at.Before(since) {
+			continue
+		}
+		durations = append(durations, sample.duration)
+		if sample.failed {
+			failed++
+		}
+	}
+	s.mu.Unlock()
+
+	stats.Requests = len(durations)
+	if len(durations) == 0 {
+		return
+	}
+	slices.Sort(durations)
+	stats.ErrorRate = float64(failed) / float64(len(durations))
+	stats.P50Ms = percentile(durations, 0.5)
+	stats.P90Ms = percentile(durations, 0.9)
+	stats.P99Ms = percentile(durations, 0.99)
+}
+
+// percentile takes the nearest rank from sorted durations, in milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
@@ -0,0 +1,47 @@
+package services_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"test-task/internal/services"
+	"testing"
+	"time"
+)
+
+func TestServerInfo_Stats(t *testing.T) {
+	server := services.NewServerInfo("http://a", "/health")
+	server.SetHealthy(true)
+	server.IncConnections()
+
+	stats := server.Stats()
+	assert.Equal(t, "http://a", stats.Address)
+	assert.True(t, stats.Healthy)
+	assert.Equal(t, int32(1), stats.Connections)
+	assert.Zero(t, stats.Requests)
+	assert.Zero(t, stats.P50Ms)
+
+	for i := 1; i <= 100; i++ {
+		server.ObserveRequest(time.Duration(i)*time.Millisecond, i%10 == 0)
+	}
+
+	stats = server.Stats()
+	assert.Equal(t, 100, stats.Requests)
+	assert.InDelta(t, 0.1, stats.ErrorRate, 1e-9)
+	assert.Equal(t, 50.0, stats.P50Ms)
+	assert.Equal(t, 90.0, stats.P90Ms)
+	assert.Equal(t, 99.0, stats.P99Ms)
+}
+
+func TestServerInfo_StatsKeepLatestRequests(t *testing.T) {
+	server := services.NewServerInfo("http://a", "/health")
+	for range 2000 {
+		server.ObserveRequest(time.Second, true)
+	}
+	for range 1024 {
+		server.ObserveRequest(time.Millisecond, false)
+	}
+
+	stats := server.Stats()
+	assert.Equal(t, 1024, stats.Requests)
+	assert.Zero(t, stats.ErrorRate)
+	assert.Equal(t, 1.0, stats.P99Ms)
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	defaultWebhookTimeout    = 5 * time.Second
+	defaultWebhookRetryDelay = time.Second
+	// webhookQueueSize bounds events waiting for a slow receiver, newer events
+	// are dropped when it's full.
+	webhookQueueSize = 1000
+)
+
+type WebhookConfig struct {
+	URL string
+	// Events limits the notifications to these types, empty means all.
+	Events []EventType
+	// Timeout limits a single attempt. Defaults to 5s.
+	Timeout time.Duration
+	// MaxRetries is the number of attempts after the first failed one.
+	MaxRetries int
+	// RetryDelay is doubled after every failed attempt. Defaults to 1s.
+	RetryDelay time.Duration
+}
+
+// Webhook posts events as JSON to an external URL. Events are sent one at a
+// time in the order they happened, a failed delivery is retried with
+// exponential backoff and then given up.
+type Webhook struct {
+	config WebhookConfig
+	client http.Client
+	queue  chan Event
+	done   chan struct{}
+}
+
+func NewWebhook(config WebhookConfig) (*Webhook, error) {
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q", config.URL)
+	}
+	if config.MaxRetries < 0 {
+		return nil, errors.New("negative webhook retries")
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = defaultWebhookTimeout
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = defaultWebhookRetryDelay
+	}
+
+	return &Webhook{
+		config: config,
+		client: http.Client{Timeout: config.Timeout},
+		queue:  make(chan Event, webhookQueueSize),
+		done:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Notify queues the event for delivery, it's meant to be subscribed to an
+// EventBus.
+func (w *Webhook) Notify(event Event) {
+	if len(w.config.Events) > 0 && !slices.Contains(w.config.Events, event.Type) {
+		return
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		slog.Warn("webhook queue is full, event dropped", "url", w.config.URL, "type", event.Type, "address", event.Server)
+	}
+}
+
+func (w *Webhook) Run(ctx context.Context) {
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.done <- struct{}{}
+			return
+		case event := <-w.queue:
+			w.deliver(ctx, event)
+		}
+	}
+}
+
+func (w *Webhook) WaitForStop() {
+	<-w.done
+}
+
+func (w *Webhook) deliver(ctx context.Context, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode event", "error", err)
+		return
+	}
+
+	delay := w.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err = w.send(ctx, body)
+		if err == nil {
+			return
+		}
+		if attempt == w.config.MaxRetries {
+			break
+		}
+
+		slog.Debug("webhook delivery failed, retrying", "url", w.config.URL, "attempt", attempt+1, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	slog.Error("webhook delivery failed",
+		"url", w.config.URL,
+		"type", event.Type,
+		"address", event.Server,
+		"attempts", w.config.MaxRetries+1,
+		"error", err,
+	)
+}
+
+func (w *Webhook) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"test-task/internal/services"
+	"testing"
+	"time"
+)
+
+type webhookReceiver struct {
+	*httptest.Server
+	failures atomic.Int32
+	attempts atomic.Int32
+	mu       sync.Mutex
+	events   []services.Event
+}
+
+// newWebhookReceiver fails the first failures requests with 500.
+func newWebhookReceiver(t *testing.T, failures int32) *webhookReceiver {
+	receiver := &webhookReceiver{}
+	receiver.failures.Store(failures)
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receiver.attempts.Add(1)
+		if receiver.failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var event services.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+
+		receiver.mu.Lock()
+		receiver.events = append(receiver.events, event)
+		receiver.mu.Unlock()
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) received() []services.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]services.Event(nil), r.events...)
+}
+
+func runWebhook(t *testing.T, config services.WebhookConfig) *services.Webhook {
+	webhook, err := services.NewWebhook(config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go webhook.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		webhook.WaitForStop()
+	})
+	return webhook
+}
+
+func TestWebhook_Delivers(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	webhook := runWebhook(t, services.WebhookConfig{URL: receiver.URL})
+
+	bus := services.NewEventBus()
+	bus.Subscribe(webhook.Notify)
+	server := services.NewServerInfo("http://a", "/health")
+	server.SetEvents(bus)
+	server.SetHealthy(true)
+	server.Eject("upstream timeout")
+
+	require.Eventually(t, func() bool { return len(receiver.received()) == 2 }, time.Second, 5*time.Millisecond)
+	events := receiver.received()
+	assert.Equal(t, services.EventHealthChanged, events[0].Type)
+	assert.True(t, events[0].Healthy)
+	assert.Equal(t, services.EventEjected, events[1].Type)
+	assert.Equal(t, "http://a", events[1].Server)
+	assert.Equal(t, "upstream timeout", events[1].Reason)
+}
+
+func TestWebhook_Retries(t *testing.T) {
+	receiver := newWebhookReceiver(t, 2)
+	webhook := runWebhook(t, services.WebhookConfig{URL: receiver.URL, MaxRetries: 2, RetryDelay: time.Millisecond})
+
+	webhook.Notify(services.Event{Type: services.EventAdded, Server: "http://a"})
+
+	require.Eventually(t, func() bool { return len(receiver.received()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(3), receiver.attempts.Load())
+}
+
+func TestWebhook_GivesUp(t *testing.T) {
+	receiver := newWebhookReceiver(t, 100)
+	webhook := runWebhook(t, services.WebhookConfig{URL: receiver.URL, MaxRetries: 1, RetryDelay: time.Millisecond})
+
+	webhook.Notify(services.Event{Type: services.EventAdded, Server: "http://a"})
+	webhook.Notify(services.Event{Type: services.EventRemoved, Server: "http://a"})
+
+	require.Eventually(t, func() bool { return receiver.attempts.Load() == 4 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(4), receiver.attempts.Load())
+	assert.Empty(t, receiver.received())
+}
+
+func TestWebhook_FiltersEvents(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	webhook := runWebhook(t, services.WebhookConfig{
+		URL:    receiver.URL,
+		Events: []services.EventType{services.EventEjected},
+	})
+
+	webhook.Notify(services.Event{Type: services.EventAdded, Server: "http://a"})
+	webhook.Notify(services.Event{Type: services.EventEjected, Server: "http://b"})
+
+	require.Eventually(t, func() bool { return len(receiver.received()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "http://b", receiver.received()[0].Server)
+	assert.Equal(t, int32(1), receiver.attempts.Load())
+}
+
+func TestNewWebhook_InvalidURL(t *testing.T) {
+	_, err := services.NewWebhook(services.WebhookConfig{URL: "ftp://example.com"})
+	assert.Error(t, err)
+	_, err = services.NewWebhook(services.WebhookConfig{URL: "http://"})
+	assert.Error(t, err)
+}
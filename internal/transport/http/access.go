@@ -0,0 +1,337 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwtLeeway allows for clock skew between the balancer and the token issuer
+// when checking exp, nbf and iat.
+const jwtLeeway = 30 * time.Second
+
+// Access restricts who may use a route. Deny wins over Allow, and a non-empty
+// Allow rejects every address it doesn't list. When both BasicAuth and JWT
+// are configured, either of them is enough.
+type Access struct {
+	Allow     []string `validate:"dive,cidr"`
+	Deny      []string `validate:"dive,cidr"`
+	BasicAuth BasicAuth
+	JWT       JWTAuth
+}
+
+type BasicAuth struct {
+	Realm string
+	// Users are "name:bcrypt-hash" pairs, as produced by htpasswd -B.
+	Users []string `validate:"dive,contains=:"`
+}
+
+type JWTAuth struct {
+	JWKSFile string `validate:"omitempty,file"`
+	Issuer   string
+	Audience string
+}
+
+func (a Access) empty() bool {
+	return len(a.Allow) == 0 && len(a.Deny) == 0 && len(a.BasicAuth.Users) == 0 && a.JWT.JWKSFile == ""
+}
+
+type accessControl struct {
+	allow, deny    []*net.IPNet
+	trustedProxies []*net.IPNet
+
+	realm    string
+	users    map[string][]byte
+	verified sync.Map // sha256 of verified credentials, bcrypt is slow
+
+	keys      map[string]any
+	jwtParser *jwt.Parser
+}
+
+func newAccessControl(access Access, trustedProxies []*net.IPNet) (*accessControl, error) {
+	ac := &accessControl{
+		allow:          mustParseCIDRs(access.Allow),
+		deny:           mustParseCIDRs(access.Deny),
+		trustedProxies: trustedProxies,
+		realm:          access.BasicAuth.Realm,
+	}
+	if ac.realm == "" {
+		ac.realm = "Restricted"
+	}
+
+	if len(access.BasicAuth.Users) > 0 {
+		ac.users = make(map[string][]byte)
+		for _, user := range access.BasicAuth.Users {
+			name, hash, _ := strings.Cut(user, ":")
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("invalid bcrypt hash for user %q: %w", name, err)
+			}
+			ac.users[name] = []byte(hash)
+		}
+	}
+
+	if access.JWT.JWKSFile != "" {
+		keys, err := loadJWKS(access.JWT.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		ac.keys = keys
+
+		// Tokens without exp would be valid forever.
+		options := []jwt.ParserOption{
+			jwt.WithValidMethods([]string{
+				"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512",
+			}),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(jwtLeeway),
+		}
+		if access.JWT.Issuer != "" {
+			options = append(options, jwt.WithIssuer(access.JWT.Issuer))
+		}
+		if access.JWT.Audience != "" {
+			options = append(options, jwt.WithAudience(access.JWT.Audience))
+		}
+		ac.jwtParser = jwt.NewParser(options...)
+	}
+
+	return ac, nil
+}
+
+func (ac *accessControl) Middleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := ac.clientIP(r)
+		if !ac.ipAllowed(clientIP) {
+			slog.Warn("access denied", "client", clientIP, "url", r.URL.String())
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if ac.users == nil && ac.jwtParser == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := ac.authenticate(r); err != nil {
+			slog.Warn("authentication failed", "client", clientIP, "url", r.URL.String(), "error", err)
+			if ac.users != nil {
+				w.Header().Add("WWW-Authenticate", `Basic realm=`+strconv.Quote(ac.realm))
+			}
+			if ac.jwtParser != nil {
+				w.Header().Add("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP trusts X-Forwarded-For only when the connection comes from a
+// trusted proxy, and then takes the last address not added by one.
+func (ac *accessControl) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if !contains(ac.trustedProxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !contains(ac.trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func (ac *accessControl) ipAllowed(ip net.IP) bool {
+	if ip == nil {
+		return len(ac.allow) == 0 && len(ac.deny) == 0
+	}
+	if contains(ac.deny, ip) {
+		return false
+	}
+	return len(ac.allow) == 0 || contains(ac.allow, ip)
+}
+
+func (ac *accessControl) authenticate(r *http.Request) error {
+	scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+
+	switch {
+	case strings.EqualFold(scheme, "Basic") && ac.users != nil:
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			return errors.New("malformed basic credentials")
+		}
+		return ac.checkPassword(user, password)
+	case strings.EqualFold(scheme, "Bearer") && ac.jwtParser != nil:
+		_, err := ac.jwtParser.Parse(strings.TrimSpace(credentials), ac.jwtKey)
+		return err
+	default:
+		return errors.New("missing credentials")
+	}
+}
+
+func (ac *accessControl) checkPassword(user, password string) error {
+	hash, ok := ac.users[user]
+	if !ok {
+		return fmt.Errorf("unknown user %q", user)
+	}
+
+	sum := sha256.Sum256([]byte(user + "\x00" + password))
+	if known, ok := ac.verified.Load(user); ok && subtle.ConstantTimeCompare(known.([]byte), sum[:]) == 1 {
+		return nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return fmt.Errorf("wrong password for user %q", user)
+	}
+	ac.verified.Store(user, sum[:])
+	return nil
+}
+
+func (ac *accessControl) jwtKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := ac.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(ac.keys) == 1 {
+		for _, key := range ac.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func loadJWKS(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]any)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func mustParseCIDRs(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		// already checked by the validator
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package http_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+func newAccessHandler(t *testing.T, access myhttp.Access) http.Handler {
+	config := defaultConfig
+	config.TrustedProxies = []string{"10.0.0.0/8"}
+	config.Routes = []myhttp.Route{{Path: "/admin/", Access: access}}
+
+	server := newBackend(t, "backend")
+	return newHandler(t, config, server)
+}
+
+func request(handler http.Handler, path, remoteAddr string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAccess_CIDRLists(t *testing.T) {
+	handler := newAccessHandler(t, myhttp.Access{
+		Allow: []string{"192.168.0.0/16"},
+		Deny:  []string{"192.168.1.0/24"},
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   int
+	}{
+		{"allowed", "192.168.2.5:1000", "", http.StatusOK},
+		{"denied wins over allowed", "192.168.1.5:1000", "", http.StatusForbidden},
+		{"not in allow list", "203.0.113.1:1000", "", http.StatusForbidden},
+		{"forwarded by trusted proxy", "10.0.0.1:1000", "192.168.2.5", http.StatusOK},
+		{"proxy chain", "10.0.0.1:1000", "192.168.2.5, 10.0.0.2", http.StatusOK},
+		{"spoofed hop before client", "10.0.0.1:1000", "192.168.2.5, 203.0.113.1", http.StatusForbidden},
+		{"forwarded by untrusted peer", "203.0.113.1:1000", "192.168.2.5", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := request(handler, "/admin/", tt.remoteAddr, "X-Forwarded-For", tt.forwarded)
+			assert.Equal(t, tt.expected, rec.Code)
+		})
+	}
+
+	// other routes are not restricted
+	assert.Equal(t, http.StatusOK, request(handler, "/public", "203.0.113.1:1000").Code)
+}
+
+func TestAccess_BasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	handler := newAccessHandler(t, myhttp.Access{
+		BasicAuth: myhttp.BasicAuth{Realm: "admin", Users: []string{"ops:" + string(hash)}},
+	})
+
+	basic := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+
+	rec := request(handler, "/admin/", "192.0.2.1:1000")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Basic realm="admin"`, rec.Header().Get("WWW-Authenticate"))
+
+	assert.Equal(t, http.StatusUnauthorized, request(handler, "/admin/", "192.0.2.1:1000", "Authorization", basic("ops", "wrong")).Code)
+	assert.Equal(t, http.StatusUnauthorized, request(handler, "/admin/", "192.0.2.1:1000", "Authorization", basic("root", "s3cret")).Code)
+
+	for range 2 {
+		assert.Equal(t, http.StatusOK, request(handler, "/admin/", "192.0.2.1:1000", "Authorization", basic("ops", "s3cret")).Code)
+	}
+}
+
+func TestAccess_BasicAuthInvalidHash(t *testing.T) {
+	config := defaultConfig
+	config.Routes = []myhttp.Route{{Path: "/admin/", Access: myhttp.Access{
+		BasicAuth: myhttp.BasicAuth{Users: []string{"ops:plaintext"}},
+	}}}
+
+	_, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer(nil))
+	assert.Error(t, err)
+}
+
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestAccess_JWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	handler := newAccessHandler(t, myhttp.Access{
+		JWT: myhttp.JWTAuth{JWKSFile: writeJWKS(t, "k1", &key.PublicKey), Issuer: "auth", Audience: "lb"},
+	})
+
+	sign := func(key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return "Bearer " + signed
+	}
+	claims := func(iss string, exp time.Duration) jwt.MapClaims {
+		return jwt.MapClaims{"iss": iss, "aud": "lb", "sub": "ops", "exp": time.Now().Add(exp).Unix()}
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		expected      int
+	}{
+		{"valid", sign(key, "k1", claims("auth", time.Hour)), http.StatusOK},
+		{"expired", sign(key, "k1", claims("auth", -time.Hour)), http.StatusUnauthorized},
+		{"expired within leeway", sign(key, "k1", claims("auth", -10*time.Second)), http.StatusOK},
+		{"no expiration", sign(key, "k1", jwt.MapClaims{"iss": "auth", "aud": "lb", "sub": "ops"}), http.StatusUnauthorized},
+		{"wrong issuer", sign(key, "k1", claims("other", time.Hour)), http.StatusUnauthorized},
+		{"unknown key", sign(key, "k2", claims("auth", time.Hour)), http.StatusUnauthorized},
+		{"wrong signature", sign(otherKey, "k1", claims("auth", time.Hour)), http.StatusUnauthorized},
+		{"missing", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := request(handler, "/admin/", "192.0.2.1:1000", "Authorization", tt.authorization)
+			assert.Equal(t, tt.expected, rec.Code)
+		})
+	}
+}
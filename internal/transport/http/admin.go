@@ -0,0 +1,146 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type AdminConfig struct {
+	Port    int `validate:"required,min=1,max=65535"`
+	Cache   *Cache
+	Mirrors []*Mirror
+	Splits  []*Split
+	// Pools are shown on the status page, in this order.
+	Pools []AdminPool `validate:"dive"`
+}
+
+// NewAdminServer builds the server for operational endpoints. It is meant to
+// listen on a separate, non-public port.
+func NewAdminServer(config AdminConfig) (*http.Server, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	shutdown := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /{$}", dashboardHandler())
+	mux.Handle("GET /status", statusHandler(config))
+	mux.Handle("GET /status/events", statusEventsHandler(config, shutdown))
+	if config.Cache != nil {
+		mux.Handle("POST /cache/purge", cachePurgeHandler(config.Cache))
+	}
+	if len(config.Mirrors) > 0 {
+		mux.Handle("GET /mirrors", mirrorStatsHandler(config.Mirrors))
+	}
+	if len(config.Splits) > 0 {
+		mux.Handle("GET /splits", splitStatsHandler(config.Splits))
+		mux.Handle("PUT /splits", splitWeightsHandler(config.Splits))
+	}
+
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(config.Port),
+		Handler: recoverMiddleware(mux),
+	}
+	// event streams never finish on their own
+	server.RegisterOnShutdown(func() { close(shutdown) })
+	return server, nil
+}
+
+func cachePurgeHandler(cache *Cache) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, prefix := r.URL.Query().Get("key"), r.URL.Query().Get("prefix")
+
+		var purged int
+		switch {
+		case key != "" && prefix == "":
+			purged = cache.Purge(key)
+		case prefix != "" && key == "":
+			purged = cache.PurgePrefix(prefix)
+		default:
+			http.Error(w, "exactly one of key or prefix is required", http.StatusBadRequest)
+			return
+		}
+
+		slog.Info("cache purged", "key", key, "prefix", prefix, "entries", purged)
+		writeJSON(w, map[string]int{"purged": purged})
+	})
+}
+
+func mirrorStatsHandler(mirrors []*Mirror) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, mirrorStats(mirrors))
+	})
+}
+
+func mirrorStats(mirrors []*Mirror) []MirrorStats {
+	stats := make([]MirrorStats, len(mirrors))
+	for i, m := range mirrors {
+		stats[i] = m.Stats()
+	}
+	return stats
+}
+
+func splitStatsHandler(splits []*Split) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, splitStats(splits))
+	})
+}
+
+func splitStats(splits []*Split) []SplitStats {
+	stats := make([]SplitStats, len(splits))
+	for i, s := range splits {
+		stats[i] = s.Stats()
+	}
+	return stats
+}
+
+// splitWeightsHandler changes the weights of a route's split, e.g.
+// PUT /splits?route=/api/ with {"default": 80, "canary": 20}.
+func splitWeightsHandler(splits []*Split) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Query().Get("route")
+
+		var split *Split
+		for _, s := range splits {
+			if s.config.Route == route {
+				split = s
+			}
+		}
+		if split == nil {
+			http.Error(w, "unknown route", http.StatusNotFound)
+			return
+		}
+
+		var weights map[string]int
+		if err := json.NewDecoder(r.Body).Decode(&weights); err != nil {
+			http.Error(w, "invalid weights: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := split.SetWeights(weights); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stats := split.Stats()
+		slog.Info("traffic split updated", "route", route, "weights", stats.Weights)
+		writeJSON(w, stats)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
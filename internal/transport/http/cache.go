@@ -0,0 +1,486 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheStatusHeader = "X-Cache"
+	cacheHit          = "HIT"
+	cacheMiss         = "MISS"
+)
+
+var cacheableStatuses = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// Cache is an in-memory HTTP cache bounded by the total size of stored
+// responses. Least recently used responses are evicted first. Responses are
+// kept apart per scope, the listener and the split pool that served them, so
+// one cache can be shared by all listeners.
+type Cache struct {
+	maxBytes      int64
+	maxEntryBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+	vary    map[string][]string
+}
+
+type cacheEntry struct {
+	key        string
+	baseKey    string
+	status     int
+	header     http.Header
+	body       []byte
+	storedAt   time.Time
+	freshUntil time.Time
+}
+
+func NewCache(maxBytes int64, maxEntryBytes int64) *Cache {
+	if maxEntryBytes <= 0 || maxEntryBytes > maxBytes {
+		maxEntryBytes = maxBytes
+	}
+	return &Cache{
+		maxBytes:      maxBytes,
+		maxEntryBytes: maxEntryBytes,
+		lru:           list.New(),
+		entries:       make(map[string]*list.Element),
+		vary:          make(map[string][]string),
+	}
+}
+
+// Purge removes all variants stored for the key and returns their number.
+// Keys have the form host + request URI, e.g. "example.com/path?query".
+func (c *Cache) Purge(key string) int {
+	return c.purge(func(baseKey string) bool { return baseKey == key })
+}
+
+func (c *Cache) PurgePrefix(prefix string) int {
+	return c.purge(func(baseKey string) bool { return strings.HasPrefix(baseKey, prefix) })
+}
+
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+func (c *Cache) purge(match func(baseKey string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for _, elem := range c.entries {
+		if match(elem.Value.(*cacheEntry).baseKey) {
+			c.remove(elem)
+			purged++
+		}
+	}
+	for scopedKey := range c.vary {
+		if match(scopedKey[strings.LastIndexByte(scopedKey, 0)+1:]) {
+			delete(c.vary, scopedKey)
+		}
+	}
+	return purged
+}
+
+func (c *Cache) get(scope string, r *http.Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[c.key(scope, r)]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry)
+}
+
+func (c *Cache) set(scope string, r *http.Request, entry *cacheEntry) {
+	size := entry.size()
+	// a response from a fallback pool doesn't belong to the picked pool
+	if size > c.maxEntryBytes || splitFellBack(r) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.vary[scopedKey(scope, r)] = varyHeaders(entry.header)
+	entry.key = c.key(scope, r)
+
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += size
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.key)
+	c.size -= entry.size()
+}
+
+// key builds the variant key from the scoped base key and the request
+// headers the origin listed in Vary. Must be called with c.mu held.
+func (c *Cache) key(scope string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(scopedKey(scope, r))
+	for _, name := range c.vary[scopedKey(scope, r)] {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// baseKey is the resource a response belongs to, purges match it in every
+// scope.
+func baseKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+func scopedKey(scope string, r *http.Request) string {
+	return scope + "\x00" + splitPool(r) + "\x00" + baseKey(r)
+}
+
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.body))
+	for name, values := range e.header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	return now.Sub(e.storedAt)
+}
+
+func (e *cacheEntry) isFresh(now time.Time, requestCC map[string]string) bool {
+	if _, ok := requestCC["no-cache"]; ok {
+		return false
+	}
+	if maxAge, ok := parseSeconds(requestCC, "max-age"); ok && e.age(now) > maxAge {
+		return false
+	}
+	return now.Before(e.freshUntil)
+}
+
+// Middleware caches the responses of next under the given scope, e.g. the
+// listener name.
+func (c *Cache) Middleware(scope string, next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if r.Method != http.MethodOptions && r.Method != http.MethodTrace {
+				c.Purge(baseKey(r))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestCC := parseCacheControl(r.Header.Get("Cache-Control"))
+		if _, ok := requestCC["no-store"]; ok || r.Header.Get("Authorization") != "" {
+			w.Header().Set(cacheStatusHeader, cacheMiss)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		entry := c.get(scope, r)
+		if entry != nil && entry.isFresh(now, requestCC) {
+			c.serve(w, r, entry, now)
+			return
+		}
+
+		upstream := r.Clone(r.Context())
+		for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+			upstream.Header.Del(name)
+		}
+
+		revalidating := false
+		if entry != nil {
+			if etag := entry.header.Get("ETag"); etag != "" {
+				upstream.Header.Set("If-None-Match", etag)
+				revalidating = true
+			}
+			if lastModified := entry.header.Get("Last-Modified"); lastModified != "" {
+				upstream.Header.Set("If-Modified-Since", lastModified)
+				revalidating = true
+			}
+		}
+
+		rec := &cacheRecorder{ResponseWriter: w, revalidating: revalidating, limit: c.maxEntryBytes}
+		next.ServeHTTP(rec, upstream)
+
+		now = time.Now()
+		if rec.notModified {
+			refreshed := *entry
+			refreshed.header = entry.header.Clone()
+			for name, values := range rec.header {
+				if name != "Content-Length" {
+					refreshed.header[name] = values
+				}
+			}
+			refreshed.storedAt = now
+			refreshed.freshUntil = now.Add(freshnessLifetime(refreshed.header, now))
+			c.set(scope, r, &refreshed)
+
+			slog.Debug("cache entry revalidated", "key", baseKey(r))
+			c.serve(w, r, &refreshed, now)
+			return
+		}
+
+		if r.Method == http.MethodGet && rec.cacheable() {
+			c.set(scope, r, &cacheEntry{
+				baseKey:    baseKey(r),
+				status:     rec.status,
+				header:     rec.storedHeader(),
+				body:       rec.body.Bytes(),
+				storedAt:   now,
+				freshUntil: now.Add(freshnessLifetime(rec.header, now)),
+			})
+		}
+	})
+}
+
+func (c *Cache) serve(w http.ResponseWriter, r *http.Request, entry *cacheEntry, now time.Time) {
+
+	header := w.Header()
+	for name, values := range entry.header {
+		header[name] = values
+	}
+	header.Set("Age", strconv.Itoa(int(entry.age(now).Seconds())))
+	header.Set(cacheStatusHeader, cacheHit)
+
+	status := entry.status
+	if status == http.StatusOK && notModified(r, entry.header) {
+		status = http.StatusNotModified
+	}
+
+	slog.Info("HTTP request served from cache", "method", r.Method, "url", r.URL.String(), "status", status)
+
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead && status != http.StatusNotModified {
+		_, _ = w.Write(entry.body)
+	}
+}
+
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || (etag != "" && strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/")) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !lastModified.After(ims)
+}
+
+// cacheRecorder passes the upstream response to the client while keeping a
+// copy for the cache. A 304 answer to our own revalidation request is not
+// passed through, the cached response is served instead.
+type cacheRecorder struct {
+	http.ResponseWriter
+	revalidating bool
+	limit        int64
+
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	truncated   bool
+	wroteHeader bool
+	notModified bool
+}
+
+func (rec *cacheRecorder) WriteHeader(code int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.status = code
+	rec.header = rec.ResponseWriter.Header().Clone()
+
+	if code == http.StatusNotModified && rec.revalidating {
+		rec.notModified = true
+		for name := range rec.header {
+			rec.ResponseWriter.Header().Del(name)
+		}
+		return
+	}
+
+	rec.ResponseWriter.Header().Set(cacheStatusHeader, cacheMiss)
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.notModified {
+		return len(b), nil
+	}
+
+	if !rec.truncated {
+		if int64(rec.body.Len()+len(b)) > rec.limit {
+			rec.truncated = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *cacheRecorder) Flush() {
+	if !rec.notModified {
+		_ = http.NewResponseController(rec.ResponseWriter).Flush()
+	}
+}
+
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func (rec *cacheRecorder) cacheable() bool {
+	if !rec.wroteHeader || rec.truncated || !cacheableStatuses[rec.status] {
+		return false
+	}
+
+	cc := parseCacheControl(rec.header.Get("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	if rec.header.Get("Vary") == "*" || len(rec.header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	if hasExplicitFreshness(rec.header) {
+		return true
+	}
+	// Without freshness information the response is stored only when it can
+	// be revalidated, and every hit is revalidated.
+	return rec.header.Get("ETag") != "" || rec.header.Get("Last-Modified") != ""
+}
+
+func (rec *cacheRecorder) storedHeader() http.Header {
+	header := rec.header.Clone()
+	header.Del(cacheStatusHeader)
+	header.Del("Age")
+	return header
+}
+
+func hasExplicitFreshness(header http.Header) bool {
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := cc["s-maxage"]; ok {
+		return true
+	}
+	if _, ok := cc["max-age"]; ok {
+		return true
+	}
+	return header.Get("Expires") != ""
+}
+
+// freshnessLifetime follows RFC 9111: s-maxage, then max-age, then Expires
+// relative to Date. no-cache responses are always stale.
+func freshnessLifetime(header http.Header, now time.Time) time.Duration {
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if lifetime, ok := parseSeconds(cc, "s-maxage"); ok {
+		return lifetime
+	}
+	if lifetime, ok := parseSeconds(cc, "max-age"); ok {
+		return lifetime
+	}
+
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = now
+	}
+	return max(expires.Sub(date), 0)
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
+
+func parseSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
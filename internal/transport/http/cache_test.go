@@ -0,0 +1,220 @@
+package http_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+)
+
+type cacheBackend struct {
+	hits        atomic.Int32
+	conditional atomic.Int32
+}
+
+func newCacheBackend(t *testing.T) (*cacheBackend, *services.ServerInfo) {
+	b := &cacheBackend{}
+	return b, newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		b.hits.Add(1)
+
+		switch r.URL.Path {
+		case "/fresh", "/api/a", "/api/b":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			_, _ = io.WriteString(w, r.Header.Get("Accept-Language"))
+			return
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				b.conditional.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/large":
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, strings.Repeat("x", 2048))
+			return
+		}
+		_, _ = io.WriteString(w, "body of "+r.URL.Path)
+	})
+}
+
+func newCachedHandler(t *testing.T, cache *myhttp.Cache, server *services.ServerInfo) http.Handler {
+	config := defaultConfig
+	config.Cache = cache
+
+	return newHandler(t, config, server)
+}
+
+func TestCache_FreshResponse(t *testing.T) {
+	backend, server := newCacheBackend(t)
+	handler := newCachedHandler(t, myhttp.NewCache(1<<20, 1<<20), server)
+
+	rec := get(handler, "/fresh")
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "body of /fresh", rec.Body.String())
+
+	rec = get(handler, "/fresh")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "body of /fresh", rec.Body.String())
+	assert.Equal(t, "0", rec.Header().Get("Age"))
+	assert.Equal(t, int32(1), backend.hits.Load())
+
+	rec = get(handler, "/fresh", "Cache-Control", "no-cache")
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+	assert.Equal(t, int32(2), backend.hits.Load())
+}
+
+func TestCache_NoStore(t *testing.T) {
+	backend, server := newCacheBackend(t)
+	handler := newCachedHandler(t, myhttp.NewCache(1<<20, 1<<20), server)
+
+	get(handler, "/no-store")
+	rec := get(handler, "/no-store")
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+	assert.Equal(t, int32(2), backend.hits.Load())
+}
+
+func TestCache_Vary(t *testing.T) {
+	backend, server := newCacheBackend(t)
+	handler := newCachedHandler(t, myhttp.NewCache(1<<20, 1<<20), server)
+
+	assert.Equal(t, "en", get(handler, "/vary", "Accept-Language", "en").Body.String())
+	assert.Equal(t, "de", get(handler, "/vary", "Accept-Language", "de").Body.String())
+
+	rec := get(handler, "/vary", "Accept-Language", "en")
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "en", rec.Body.String())
+	assert.Equal(t, int32(2), backend.hits.Load())
+}
+
+func TestCache_Revalidation(t *testing.T) {
+	backend, server := newCacheBackend(t)
+	handler := newCachedHandler(t, myhttp.NewCache(1<<20, 1<<20), server)
+
+	assert.Equal(t, "MISS", get(handler, "/etag").Header().Get("X-Cache"))
+
+	rec := get(handler, "/etag")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "body of /etag", rec.Body.String())
+	assert.Equal(t, int32(1), backend.conditional.Load())
+
+	rec = get(handler, "/etag", "If-None-Match", `"v1"`)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	backend, server := newCacheBackend(t)
+	cache := myhttp.NewCache(200, 200)
+	handler := newCachedHandler(t, cache, server)
+
+	get(handler, "/api/a")
+	get(handler, "/api/b")
+	get(handler, "/fresh")
+	assert.LessOrEqual(t, cache.Size(), int64(200))
+	assert.Equal(t, int32(3), backend.hits.Load())
+
+	assert.Equal(t, "HIT", get(handler, "/fresh").Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", get(handler, "/api/a").Header().Get("X-Cache"))
+
+	// larger than max_entry_bytes
+	get(handler, "/large")
+	assert.Equal(t, "MISS", get(handler, "/large").Header().Get("X-Cache"))
+}
+
+func TestCache_AdminPurge(t *testing.T) {
+	_, server := newCacheBackend(t)
+	cache := myhttp.NewCache(1<<20, 1<<20)
+	handler := newCachedHandler(t, cache, server)
+
+	admin, err := myhttp.NewAdminServer(myhttp.AdminConfig{Port: 9091, Cache: cache})
+	require.NoError(t, err)
+
+	get(handler, "/api/a")
+	get(handler, "/api/b")
+	get(handler, "/fresh")
+
+	req := httptest.NewRequest(http.MethodPost, "/cache/purge?prefix=example.com/api/", nil)
+	rec := httptest.NewRecorder()
+	admin.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"purged": 2}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/cache/purge?key=example.com/fresh", nil)
+	rec = httptest.NewRecorder()
+	admin.Handler.ServeHTTP(rec, req)
+	assert.JSONEq(t, `{"purged": 1}`, rec.Body.String())
+
+	assert.Equal(t, "MISS", get(handler, "/api/a").Header().Get("X-Cache"))
+
+	req = httptest.NewRequest(http.MethodPost, "/cache/purge", nil)
+	rec = httptest.NewRecorder()
+	admin.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCache_KeptApartPerListener(t *testing.T) {
+	backend, server := newCacheBackend(t)
+	cache := myhttp.NewCache(1<<20, 1<<20)
+
+	newListener := func(name string) http.Handler {
+		config := defaultConfig
+		config.Name = name
+		config.Cache = cache
+		srv, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer([]*services.ServerInfo{server}))
+		require.NoError(t, err)
+		return srv.Handler
+	}
+	internal, public := newListener("internal"), newListener("public")
+
+	assert.Equal(t, "MISS", get(internal, "/fresh").Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", get(internal, "/fresh").Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", get(public, "/fresh").Header().Get("X-Cache"))
+	assert.Equal(t, int32(2), backend.hits.Load())
+
+	// a purge covers every listener
+	assert.Equal(t, 2, cache.Purge("example.com/fresh"))
+}
+
+func TestCache_KeptApartPerSplitPool(t *testing.T) {
+	newPool := func(name string) *services.ServerInfo {
+		return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, name)
+		})
+	}
+	canary := newPool("canary")
+	split := newSplit(t, 50, 50, newPool("stable"), canary)
+
+	config := defaultConfig
+	config.Cache = myhttp.NewCache(1<<20, 1<<20)
+	config.Routes = []myhttp.Route{{Path: "/", Split: split}}
+	srv, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer(nil))
+	require.NoError(t, err)
+
+	assert.Equal(t, "canary", get(srv.Handler, "/", "X-Canary", "canary").Body.String())
+	rec := get(srv.Handler, "/", "X-Canary", "default")
+	assert.Equal(t, "stable", rec.Body.String())
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", get(srv.Handler, "/", "X-Canary", "canary").Header().Get("X-Cache"))
+
+	// responses of a fallback pool are not cached for the picked one
+	canary.SetHealthy(false)
+	assert.Equal(t, "stable", get(srv.Handler, "/other", "X-Canary", "canary").Body.String())
+	assert.Equal(t, "MISS", get(srv.Handler, "/other", "X-Canary", "canary").Header().Get("X-Cache"))
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxCoalescedBodyBytes limits how much of a response is kept in memory to be
+// shared. Waiting requests send their own upstream request when the response
+// is larger.
+const maxCoalescedBodyBytes = 4 << 20
+
+// coalescer lets concurrent identical requests share one upstream response:
+// the first request goes upstream, the others wait for it and get a copy.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done      chan struct{}
+	shareable bool
+	status    int
+	header    http.Header
+	body      []byte
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*coalescedCall)}
+}
+
+func (c *coalescer) Middleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		key, ok := coalesceKey(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		c.mu.Lock()
+		if call, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+
+			select {
+			case <-call.done:
+			case <-r.Context().Done():
+				return
+			}
+
+			if !call.shareable {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			slog.Debug("request coalesced", "method", r.Method, "url", r.URL.String())
+			call.replay(w, r)
+			return
+		}
+
+		call := &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+
+		rec := &coalesceRecorder{ResponseWriter: w}
+		defer func() {
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+			close(call.done)
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		// A response cut short by the leader's client going away, one setting
+		// cookies or one marked private or no-store must not be handed to
+		// other clients.
+		cc := parseCacheControl(rec.header.Get("Cache-Control"))
+		_, private := cc["private"]
+		_, noStore := cc["no-store"]
+		call.shareable = rec.wroteHeader && !rec.truncated && r.Context().Err() == nil &&
+			len(rec.header.Values("Set-Cookie")) == 0 && !private && !noStore
+		call.status = rec.status
+		call.header = rec.header
+		call.body = rec.body.Bytes()
+	})
+}
+
+func (call *coalescedCall) replay(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	for name, values := range call.header {
+		header[name] = values
+	}
+	w.WriteHeader(call.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(call.body)
+	}
+}
+
+// coalesceKey identifies requests that may share a response. Requests with
+// credentials are never coalesced.
+func coalesceKey(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return "", false
+	}
+	if strings.Contains(r.Header.Get("Cache-Control"), "no-store") {
+		return "", false
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		splitPool(r),
+		r.Host,
+		r.URL.RequestURI(),
+		r.Header.Get("Accept"),
+		r.Header.Get("Accept-Encoding"),
+		r.Header.Get("Accept-Language"),
+	}, "\x00"), true
+}
+
+type coalesceRecorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	truncated   bool
+	wroteHeader bool
+}
+
+func (rec *coalesceRecorder) WriteHeader(code int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.status = code
+	rec.header = rec.ResponseWriter.Header().Clone()
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *coalesceRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.truncated {
+		if rec.body.Len()+len(b) > maxCoalescedBodyBytes {
+			rec.truncated = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *coalesceRecorder) Flush() {
+	_ = http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+func (rec *coalesceRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
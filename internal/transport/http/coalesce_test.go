@@ -0,0 +1,112 @@
+package http_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+type slowBackend struct {
+	hits    atomic.Int32
+	release chan struct{}
+}
+
+func newSlowBackend(t *testing.T) (*slowBackend, *services.ServerInfo) {
+	b := &slowBackend{release: make(chan struct{})}
+	return b, newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		b.hits.Add(1)
+		<-b.release
+		w.Header().Set("X-Backend", "slow")
+		if cc := r.URL.Query().Get("cc"); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		_, _ = io.WriteString(w, "value of "+r.URL.Path)
+	})
+}
+
+func sendConcurrently(t *testing.T, handler http.Handler, backend *slowBackend, n int, path string, headers ...string) []*httptest.ResponseRecorder {
+	recs := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range recs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recs[i] = get(handler, path, headers...)
+		}(i)
+	}
+
+	require.Eventually(t, func() bool { return backend.hits.Load() > 0 }, time.Second, time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+	return recs
+}
+
+func newCoalescingHandler(t *testing.T, server *services.ServerInfo) http.Handler {
+	config := defaultConfig
+	config.Routes = []myhttp.Route{{Path: "/hot/", Coalesce: true}}
+
+	return newHandler(t, config, server)
+}
+
+func TestCoalescing_SharesResponse(t *testing.T) {
+	backend, server := newSlowBackend(t)
+	handler := newCoalescingHandler(t, server)
+
+	recs := sendConcurrently(t, handler, backend, 10, "/hot/key")
+
+	assert.Equal(t, int32(1), backend.hits.Load())
+	for _, rec := range recs {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "value of /hot/key", rec.Body.String())
+		assert.Equal(t, "slow", rec.Header().Get("X-Backend"))
+	}
+}
+
+func TestCoalescing_OnlyConfiguredRoutes(t *testing.T) {
+	backend, server := newSlowBackend(t)
+	handler := newCoalescingHandler(t, server)
+
+	sendConcurrently(t, handler, backend, 5, "/cold/key")
+	assert.Equal(t, int32(5), backend.hits.Load())
+}
+
+func TestCoalescing_SkipsRequestsWithCredentials(t *testing.T) {
+	backend, server := newSlowBackend(t)
+	handler := newCoalescingHandler(t, server)
+
+	sendConcurrently(t, handler, backend, 5, "/hot/key", "Cookie", "session=1")
+	assert.Equal(t, int32(5), backend.hits.Load())
+}
+
+func TestCoalescing_SkipsPrivateResponses(t *testing.T) {
+	for _, cc := range []string{"private", "no-store", "max-age=60, Private"} {
+		backend, server := newSlowBackend(t)
+		handler := newCoalescingHandler(t, server)
+
+		recs := sendConcurrently(t, handler, backend, 5, "/hot/key?cc="+url.QueryEscape(cc))
+		assert.Equal(t, int32(5), backend.hits.Load(), cc)
+		for _, rec := range recs {
+			assert.Equal(t, http.StatusOK, rec.Code, cc)
+			assert.Equal(t, "value of /hot/key", rec.Body.String(), cc)
+		}
+	}
+}
+
+func TestNewServer_DuplicateRoutes(t *testing.T) {
+	config := defaultConfig
+	config.Routes = []myhttp.Route{{Path: "/api/"}, {Path: "/api/"}}
+
+	_, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer(nil))
+	assert.Error(t, err)
+}
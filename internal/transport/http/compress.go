@@ -0,0 +1,245 @@
+package http
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Compression struct {
+	Enabled bool
+	// MinSize is the smallest response body, in bytes, worth compressing.
+	MinSize int `validate:"gte=0"`
+	// ContentTypes lists compressible media types. An entry ending with "/"
+	// matches every subtype, e.g. "text/".
+	ContentTypes []string `validate:"required_if=Enabled true"`
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encodings in order of preference when the client accepts several with the
+// same quality.
+var encodings = []string{"br", "zstd", "gzip"}
+
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}},
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}},
+	"zstd": {New: func() any {
+		enc, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+}
+
+type compressor struct {
+	config Compression
+}
+
+func newCompressor(config Compression) *compressor {
+	return &compressor{config: config}
+}
+
+func (c *compressor) Middleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if r.Method == http.MethodHead || encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func (c *compressor) compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	if strings.Contains(header.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range c.config.ContentTypes {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the supported encoding with the highest quality
+// value from an Accept-Encoding header.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds the response back until MinSize bytes are written or
+// the handler flushes, then either compresses it or passes it through. A
+// flush always forces the decision so streamed responses are never buffered.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *compressor
+	encoding   string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	enc         encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = code
+
+	header := cw.ResponseWriter.Header()
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified ||
+		!cw.compressor.compressible(header) {
+		cw.passThrough()
+		return
+	}
+
+	header.Add("Vary", "Accept-Encoding")
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil {
+		if length < cw.compressor.config.MinSize {
+			cw.passThrough()
+		} else {
+			cw.startCompression()
+		}
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) >= cw.compressor.config.MinSize {
+			cw.startCompression()
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.startCompression()
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) Close() {
+	if !cw.wroteHeader {
+		return
+	}
+	if !cw.decided {
+		cw.passThrough()
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+func (cw *compressWriter) passThrough() {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) > 0 {
+		_, _ = cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+	}
+}
+
+func (cw *compressWriter) startCompression() {
+	cw.decided = true
+
+	header := cw.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	header.Set("Content-Encoding", cw.encoding)
+	// The compressed representation differs from the original byte by byte,
+	// so a strong validator has to become weak.
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", "W/"+etag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.enc = encoderPools[cw.encoding].Get().(encoder)
+	cw.enc.Reset(cw.ResponseWriter)
+	if len(cw.buf) > 0 {
+		_, _ = cw.enc.Write(cw.buf)
+		cw.buf = nil
+	}
+}
@@ -0,0 +1,151 @@
+package http_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-task/internal/services"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+var largeBody = strings.Repeat("compress me ", 200)
+
+func newCompressionBackend(t *testing.T, release chan struct{}) *services.ServerInfo {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, "tiny")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, largeBody)
+		case "/encoded":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = io.WriteString(w, "already encoded")
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, "data: first\n\n")
+			w.(http.Flusher).Flush()
+			<-release
+			_, _ = io.WriteString(w, "data: second\n\n")
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = io.WriteString(w, largeBody)
+		}
+	})
+}
+
+func newCompressingHandler(t *testing.T, server *services.ServerInfo) http.Handler {
+	config := defaultConfig
+	config.Compression = myhttp.Compression{
+		Enabled:      true,
+		MinSize:      256,
+		ContentTypes: []string{"text/", "application/json"},
+	}
+
+	return newHandler(t, config, server)
+}
+
+func decode(t *testing.T, encoding string, body io.Reader) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(body)
+		require.NoError(t, err)
+		r = gr
+	case "br":
+		r = brotli.NewReader(body)
+	case "zstd":
+		zr, err := zstd.NewReader(body)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	default:
+		r = body
+	}
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCompression_Negotiation(t *testing.T) {
+	handler := newCompressingHandler(t, newCompressionBackend(t, nil))
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "br"},
+		{"br;q=0.5, zstd", "zstd"},
+		{"br;q=0, gzip;q=0.1", "gzip"},
+		{"*", "br"},
+		{"identity", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		rec := get(handler, "/page", "Accept-Encoding", tt.acceptEncoding)
+
+		assert.Equal(t, tt.expected, rec.Header().Get("Content-Encoding"), tt.acceptEncoding)
+		assert.Equal(t, largeBody, decode(t, tt.expected, rec.Body), tt.acceptEncoding)
+		if tt.expected != "" {
+			assert.Empty(t, rec.Header().Get("Content-Length"))
+			assert.Equal(t, `W/"v1"`, rec.Header().Get("ETag"))
+			assert.Contains(t, rec.Header().Values("Vary"), "Accept-Encoding")
+		}
+	}
+}
+
+func TestCompression_SkipsIneligibleResponses(t *testing.T) {
+	handler := newCompressingHandler(t, newCompressionBackend(t, nil))
+
+	rec := get(handler, "/small", "Accept-Encoding", "gzip")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "tiny", rec.Body.String())
+
+	rec = get(handler, "/image", "Accept-Encoding", "gzip")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, largeBody, rec.Body.String())
+
+	rec = get(handler, "/encoded", "Accept-Encoding", "gzip")
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "already encoded", rec.Body.String())
+}
+
+func TestCompression_StreamsFlushedResponses(t *testing.T) {
+	release := make(chan struct{})
+	lb := httptest.NewServer(newCompressingHandler(t, newCompressionBackend(t, release)))
+	defer lb.Close()
+	defer close(release)
+
+	req, err := http.NewRequest(http.MethodGet, lb.URL+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	// The first event must arrive while the backend is still holding the
+	// response open.
+	gr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	line, err := bufio.NewReader(gr).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+}
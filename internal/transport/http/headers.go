@@ -0,0 +1,138 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+// HeaderRules modify a header set: Remove is applied first, then Set, then
+// Add. Values may contain the placeholders {client_ip}, {request_id},
+// {backend}, {host}, {method} and {path}.
+type HeaderRules struct {
+	Add    map[string]string
+	Set    map[string]string
+	Remove []string
+}
+
+func (rules HeaderRules) empty() bool {
+	return len(rules.Add) == 0 && len(rules.Set) == 0 && len(rules.Remove) == 0
+}
+
+func (rules HeaderRules) apply(header http.Header, vars *headerVars) {
+	for _, name := range rules.Remove {
+		header.Del(name)
+	}
+	for name, value := range rules.Set {
+		header.Set(name, vars.expand(value))
+	}
+	for name, value := range rules.Add {
+		header.Add(name, vars.expand(value))
+	}
+}
+
+type headerVars struct {
+	clientIP  string
+	requestID string
+	backend   string
+	host      string
+	method    string
+	path      string
+}
+
+func newHeaderVars(r *http.Request) *headerVars {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	return &headerVars{
+		clientIP:  clientIP,
+		requestID: requestID,
+		host:      r.Host,
+		method:    r.Method,
+		path:      r.URL.Path,
+	}
+}
+
+func (vars *headerVars) expand(value string) string {
+	if !strings.Contains(value, "{") {
+		return value
+	}
+
+	return strings.NewReplacer(
+		"{client_ip}", vars.clientIP,
+		"{request_id}", vars.requestID,
+		"{backend}", vars.backend,
+		"{host}", vars.host,
+		"{method}", vars.method,
+		"{path}", vars.path,
+	).Replace(value)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type headerVarsKey struct{}
+
+// requestVars returns the variables stored by headerRulesMiddleware, nil
+// when the route has no header rules.
+func requestVars(r *http.Request) *headerVars {
+	vars, _ := r.Context().Value(headerVarsKey{}).(*headerVars)
+	return vars
+}
+
+// headerRulesMiddleware sits outside the cache and the coalescer, so values
+// like {request_id} are rendered for each client instead of being stored
+// with a shared response. {backend} is empty when no backend was asked.
+func headerRulesMiddleware(route Route, next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := newHeaderVars(r)
+		if !route.ResponseHeaders.empty() {
+			w = &headerRulesWriter{ResponseWriter: w, rules: route.ResponseHeaders, vars: vars}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), headerVarsKey{}, vars)))
+	})
+}
+
+// headerRulesWriter applies response rules right before the header is sent,
+// so they cover upstream responses as well as errors generated here.
+type headerRulesWriter struct {
+	http.ResponseWriter
+	rules       HeaderRules
+	vars        *headerVars
+	wroteHeader bool
+}
+
+func (hw *headerRulesWriter) WriteHeader(code int) {
+	if !hw.wroteHeader && code >= http.StatusOK {
+		hw.wroteHeader = true
+		hw.rules.apply(hw.ResponseWriter.Header(), hw.vars)
+	}
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *headerRulesWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+func (hw *headerRulesWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,102 @@
+package http_test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+)
+
+func newEchoHeadersBackend(t *testing.T) *services.ServerInfo {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "backend/1.0")
+		w.Header().Set("X-Powered-By", "php")
+		_ = json.NewEncoder(w).Encode(r.Header)
+	})
+}
+
+func newHeaderRulesHandler(t *testing.T, servers ...*services.ServerInfo) http.Handler {
+	config := defaultConfig
+	config.Routes = []myhttp.Route{{
+		Path: "/",
+		RequestHeaders: myhttp.HeaderRules{
+			Set:    map[string]string{"X-Request-Id": "{request_id}", "X-Real-Ip": "{client_ip}"},
+			Add:    map[string]string{"X-Route": "{method} {path}"},
+			Remove: []string{"X-Internal"},
+		},
+		ResponseHeaders: myhttp.HeaderRules{
+			Set:    map[string]string{"Strict-Transport-Security": "max-age=31536000", "X-Backend": "{backend}"},
+			Remove: []string{"Server", "X-Powered-By"},
+		},
+	}}
+
+	return newHandler(t, config, servers...)
+}
+
+func TestHeaderRules_Request(t *testing.T) {
+	server := newEchoHeadersBackend(t)
+	handler := newHeaderRulesHandler(t, server)
+
+	rec := get(handler, "/items", "X-Internal", "secret", "X-Request-Id", "abc")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var received http.Header
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &received))
+	assert.Empty(t, received.Get("X-Internal"))
+	assert.Equal(t, "abc", received.Get("X-Request-Id"))
+	assert.Equal(t, "192.0.2.1", received.Get("X-Real-Ip"))
+	assert.Equal(t, "GET /items", received.Get("X-Route"))
+
+	rec = get(handler, "/items")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &received))
+	assert.Len(t, received.Get("X-Request-Id"), 32)
+}
+
+func TestHeaderRules_Response(t *testing.T) {
+	server := newEchoHeadersBackend(t)
+	handler := newHeaderRulesHandler(t, server)
+
+	rec := get(handler, "/")
+	assert.Empty(t, rec.Header().Get("Server"))
+	assert.Empty(t, rec.Header().Get("X-Powered-By"))
+	assert.Equal(t, "max-age=31536000", rec.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, server.Address(), rec.Header().Get("X-Backend"))
+}
+
+func TestHeaderRules_ErrorResponse(t *testing.T) {
+	handler := newHeaderRulesHandler(t)
+
+	rec := get(handler, "/")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "max-age=31536000", rec.Header().Get("Strict-Transport-Security"))
+}
+
+func TestHeaderRules_CachedResponse(t *testing.T) {
+	backend, server := newCacheBackend(t)
+	config := defaultConfig
+	config.Cache = myhttp.NewCache(1<<20, 1<<20)
+	config.Routes = []myhttp.Route{{
+		Path:            "/",
+		ResponseHeaders: myhttp.HeaderRules{Set: map[string]string{"X-Request-Id": "{request_id}"}},
+	}}
+	srv, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer([]*services.ServerInfo{server}))
+	require.NoError(t, err)
+
+	ids := map[string]bool{}
+	for _, id := range []string{"first", "second", "third"} {
+		rec := get(srv.Handler, "/fresh", "X-Request-Id", id)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, id, rec.Header().Get("X-Request-Id"))
+		ids[rec.Header().Get("X-Cache")] = true
+	}
+	assert.True(t, ids["HIT"])
+	assert.Equal(t, int32(1), backend.hits.Load())
+
+	rec := get(srv.Handler, "/fresh")
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Len(t, rec.Header().Get("X-Request-Id"), 32)
+}
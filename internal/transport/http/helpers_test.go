@@ -0,0 +1,85 @@
+package http_test
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+var defaultConfig = myhttp.Config{
+	Port:                8081,
+	DialTimeout:         time.Second,
+	KeepAlive:           time.Second,
+	MaxIdleConns:        10,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     time.Second,
+}
+
+// newTestBackend starts a backend answering with handler and returns it as
+// a server that already passed its first health check.
+func newTestBackend(t testing.TB, handler http.HandlerFunc) *services.ServerInfo {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return servicestest.HealthyServer(srv.URL, "/health")
+}
+
+// newBackend answers every request with its name.
+func newBackend(t *testing.T, name string) *services.ServerInfo {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name)
+	})
+}
+
+// newEchoBackend answers with the request body.
+func newEchoBackend(t *testing.T) *services.ServerInfo {
+	return newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+}
+
+// newHandler builds the balancer's handler for config over servers.
+func newHandler(t testing.TB, config myhttp.Config, servers ...*services.ServerInfo) http.Handler {
+	srv, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer(servers))
+	require.NoError(t, err)
+	return srv.Handler
+}
+
+func get(handler http.Handler, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func post(handler http.Handler, path string, body string, contentLength int64) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.ContentLength = contentLength
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// serve sends GET / with the cookies and requires a 200.
+func serve(t *testing.T, handler http.Handler, cookies ...*http.Cookie) (string, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String(), rec
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"test-task/internal/services"
+)
+
+// clientBody remembers why reading the client's request body failed, so a
+// proxy error caused by the client is not blamed on the backend.
+type clientBody struct {
+	io.ReadCloser
+	mu  sync.Mutex
+	err error
+}
+
+func (b *clientBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *clientBody) readErr() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func limitBody(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+
+	body := &clientBody{ReadCloser: r.Body}
+	if maxBytes > 0 {
+		body.ReadCloser = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+	r.Body = body
+}
+
+func rejectLargeBody(w http.ResponseWriter, r *http.Request, limit int64) {
+	slog.Warn("request body too large",
+		"client", r.RemoteAddr,
+		"url", r.URL.String(),
+		"content_length", r.ContentLength,
+		"limit", limit,
+	)
+	http.Error(w, "Request entity too large", http.StatusRequestEntityTooLarge)
+}
+
+func proxyErrorHandler(server *services.ServerInfo, limit int64) func(http.ResponseWriter, *http.Request, error) {
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var maxBytesErr *http.MaxBytesError
+		// The proxy passes the client's body on as is.
+		body, _ := r.Body.(*clientBody)
+		bodyErr := body.readErr()
+
+		switch {
+		case errors.As(bodyErr, &maxBytesErr):
+			rejectLargeBody(w, r, limit)
+		case isTimeout(bodyErr):
+			slog.Warn("client request timeout", "client", r.RemoteAddr, "url", r.URL.String(), "error", bodyErr)
+			http.Error(w, "Request timeout", http.StatusRequestTimeout)
+		case errors.Is(r.Context().Err(), context.Canceled):
+			slog.Debug("client went away", "server", server.Address(), "client", r.RemoteAddr, "url", r.URL.String())
+		case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+			// The route's upstream_timeout says the endpoint is slow, not that
+			// the server is down.
+			slog.Error("upstream timeout", "server", server.Address(), "url", r.URL.String(), "error", err)
+			http.Error(w, "Gateway timeout", http.StatusGatewayTimeout)
+		case isTimeout(err):
+			slog.Error("upstream timeout", "server", server.Address(), "url", r.URL.String(), "error", err)
+			if isConnectionError(err) {
+				server.Eject("upstream timeout")
+			}
+			http.Error(w, "Gateway timeout", http.StatusGatewayTimeout)
+		default:
+			slog.Error("proxy error", "server", server.Address(), "error", err)
+			if isConnectionError(err) {
+				server.Eject("proxy error: " + err.Error())
+			}
+			http.Error(w, "Upstream server failure", http.StatusBadGateway)
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isConnectionError reports whether err means the server couldn't be reached
+// or dropped the connection. A timeout only counts while dialing, a slow
+// response is not a reason to eject the server.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial" || !opErr.Timeout()
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
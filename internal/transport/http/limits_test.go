@@ -0,0 +1,137 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+type limitsBackend struct {
+	hits atomic.Int32
+}
+
+func newLimitsBackend(t *testing.T) (*limitsBackend, *services.ServerInfo) {
+	b := &limitsBackend{}
+	return b, newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		b.hits.Add(1)
+		if strings.HasPrefix(r.URL.Path, "/slow") {
+			time.Sleep(300 * time.Millisecond)
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+}
+
+func newLimitsServer(t *testing.T, config myhttp.Config, server *services.ServerInfo) *http.Server {
+	config.Routes = []myhttp.Route{
+		{Path: "/", MaxBodyBytes: 8},
+		{Path: "/slow", UpstreamTimeout: 50 * time.Millisecond},
+	}
+
+	srv, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer([]*services.ServerInfo{server}))
+	require.NoError(t, err)
+	return srv
+}
+
+func TestLimits_MaxBodyBytes(t *testing.T) {
+	backend, server := newLimitsBackend(t)
+	handler := newLimitsServer(t, defaultConfig, server).Handler
+
+	rec := post(handler, "/", "small", 5)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "small", rec.Body.String())
+
+	rec = post(handler, "/", "too large body", 14)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, int32(1), backend.hits.Load())
+
+	// unknown length, the limit is enforced while streaming
+	rec = post(handler, "/", "too large body", -1)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.True(t, server.IsHealthy())
+}
+
+func TestLimits_UpstreamTimeout(t *testing.T) {
+	_, server := newLimitsBackend(t)
+	handler := newLimitsServer(t, defaultConfig, server).Handler
+
+	rec := get(handler, "/slow")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	// a slow endpoint doesn't take the server out of the other routes
+	assert.True(t, server.IsHealthy())
+}
+
+func TestLimits_ClientGoesAway(t *testing.T) {
+	_, server := newLimitsBackend(t)
+	handler := newLimitsServer(t, defaultConfig, server).Handler
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	req := httptest.NewRequest(http.MethodGet, "/slow/page", nil).WithContext(ctx)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, server.IsHealthy())
+}
+
+func TestLimits_ConnectionFailureEjects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	server := servicestest.HealthyServer("http://"+ln.Addr().String(), "/health")
+	handler := newLimitsServer(t, defaultConfig, server).Handler
+
+	rec := get(handler, "/")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.False(t, server.IsHealthy())
+}
+
+func TestLimits_ResponseHeaderTimeout(t *testing.T) {
+	_, server := newLimitsBackend(t)
+	config := defaultConfig
+	config.ResponseHeaderTimeout = 50 * time.Millisecond
+	handler := newLimitsServer(t, config, server).Handler
+
+	rec := get(handler, "/slow/page")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.True(t, server.IsHealthy())
+}
+
+func TestLimits_ClientReadTimeout(t *testing.T) {
+	_, server := newLimitsBackend(t)
+	config := defaultConfig
+	config.ReadTimeout = 100 * time.Millisecond
+
+	lb := httptest.NewUnstartedServer(nil)
+	lb.Config = newLimitsServer(t, config, server)
+	lb.Start()
+	defer lb.Close()
+
+	conn, err := net.Dial("tcp", lb.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// promise 5 bytes, send 3 and stall
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: lb\r\nContent-Length: 5\r\n\r\nabc")
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+	assert.True(t, server.IsHealthy())
+}
@@ -0,0 +1,277 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"test-task/internal/backendurl"
+	"time"
+)
+
+const (
+	defaultMirrorMaxBodyBytes = 1 << 20
+	defaultMirrorTimeout      = 10 * time.Second
+	// maxMirrorsInFlight bounds shadow requests waiting on a slow shadow pool,
+	// requests over the limit are not mirrored.
+	maxMirrorsInFlight = 100
+)
+
+type MirrorConfig struct {
+	Route    string
+	Pool     string
+	Balancer Balancer `validate:"required"`
+	Percent  float64  `validate:"gt=0,lte=100"`
+	// MaxBodyBytes is the largest request body buffered for mirroring, larger
+	// requests are not mirrored. Defaults to 1MB, and never goes over the
+	// route's RouteMaxBodyBytes.
+	MaxBodyBytes      int64 `validate:"gte=0"`
+	RouteMaxBodyBytes int64 `validate:"gte=0"`
+	// Timeout limits a shadow request. Defaults to 10s.
+	Timeout time.Duration `validate:"gte=0"`
+	// The connections to the shadow pool use the proxy's settings, zero
+	// values are not limited apart from Timeout.
+	DialTimeout           time.Duration `validate:"gte=0"`
+	KeepAlive             time.Duration `validate:"gte=0"`
+	IdleConnTimeout       time.Duration `validate:"gte=0"`
+	ResponseHeaderTimeout time.Duration `validate:"gte=0"`
+}
+
+// Mirror copies a share of requests to a shadow pool. Shadow responses are
+// discarded and never affect the client, only the stats record them.
+type Mirror struct {
+	config    MirrorConfig
+	transport *http.Transport
+	inFlight  chan struct{}
+
+	mirrored         atomic.Int64
+	skipped          atomic.Int64
+	dropped          atomic.Int64
+	errors           atomic.Int64
+	statusMismatches atomic.Int64
+	compared         atomic.Int64
+	latencyDiffSum   atomic.Int64
+}
+
+type MirrorStats struct {
+	Route            string  `json:"route"`
+	Pool             string  `json:"pool"`
+	Mirrored         int64   `json:"mirrored"`
+	Skipped          int64   `json:"skipped"`
+	Dropped          int64   `json:"dropped"`
+	Errors           int64   `json:"errors"`
+	StatusMismatches int64   `json:"status_mismatches"`
+	AvgLatencyDiffMs float64 `json:"avg_latency_diff_ms"`
+}
+
+func NewMirror(config MirrorConfig) (*Mirror, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = defaultMirrorMaxBodyBytes
+	}
+	if config.RouteMaxBodyBytes > 0 {
+		config.MaxBodyBytes = min(config.MaxBodyBytes, config.RouteMaxBodyBytes)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultMirrorTimeout
+	}
+
+	transport := newTransport(Config{
+		DialTimeout:           config.DialTimeout,
+		KeepAlive:             config.KeepAlive,
+		MaxIdleConns:          maxMirrorsInFlight,
+		MaxIdleConnsPerHost:   maxMirrorsInFlight,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+	})
+
+	return &Mirror{
+		config:    config,
+		transport: transport,
+		inFlight:  make(chan struct{}, maxMirrorsInFlight),
+	}, nil
+}
+
+func (m *Mirror) Stats() MirrorStats {
+	stats := MirrorStats{
+		Route:            m.config.Route,
+		Pool:             m.config.Pool,
+		Mirrored:         m.mirrored.Load(),
+		Skipped:          m.skipped.Load(),
+		Dropped:          m.dropped.Load(),
+		Errors:           m.errors.Load(),
+		StatusMismatches: m.statusMismatches.Load(),
+	}
+	if compared := m.compared.Load(); compared > 0 {
+		avg := time.Duration(m.latencyDiffSum.Load() / compared)
+		stats.AvgLatencyDiffMs = float64(avg) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+func (m *Mirror) Middleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64()*100 >= m.config.Percent {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, ok := m.bufferBody(r)
+		if !ok {
+			m.skipped.Add(1)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case m.inFlight <- struct{}{}:
+		default:
+			m.dropped.Add(1)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		shadow := r.Clone(context.Background())
+		primary := make(chan primaryResult, 1)
+		go m.send(shadow, body, primary)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			primary <- primaryResult{status: rec.status, duration: time.Since(start)}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// bufferBody reads the request body so it can be sent twice. When the body is
+// over the limit, the part already read is put back in front of the rest.
+func (m *Mirror) bufferBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength > m.config.MaxBodyBytes {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, m.config.MaxBodyBytes+1))
+	if err != nil || int64(len(body)) > m.config.MaxBodyBytes {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false
+	}
+
+	r.Body = readCloser{bytes.NewReader(body), r.Body}
+	return body, true
+}
+
+type primaryResult struct {
+	status   int
+	duration time.Duration
+}
+
+func (m *Mirror) send(r *http.Request, body []byte, primary <-chan primaryResult) {
+	defer func() { <-m.inFlight }()
+
+	m.mirrored.Add(1)
+	server, err := m.config.Balancer.NextServer()
+	if err != nil {
+		m.errors.Add(1)
+		slog.Debug("shadow request failed", "pool", m.config.Pool, "error", err)
+		return
+	}
+
+	target := server.URL()
+	if target == nil {
+		m.errors.Add(1)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	defer cancel()
+
+	r = r.WithContext(ctx)
+	r.RequestURI = ""
+	r.URL.Scheme = target.Scheme
+	r.URL.Host = target.Host
+	r.URL.Path, r.URL.RawPath = backendurl.JoinPath(target, r.URL)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if body == nil {
+		r.Body = nil
+	}
+	for _, name := range hopHeaders {
+		r.Header.Del(name)
+	}
+	r.Header.Set("X-Shadow-Request", "1")
+
+	server.IncConnections()
+	start := time.Now()
+	resp, err := m.transport.RoundTrip(r)
+	if err != nil {
+		server.DecConnections()
+		m.errors.Add(1)
+		slog.Debug("shadow request failed", "pool", m.config.Pool, "server", server.Address(), "error", err)
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	duration := time.Since(start)
+	server.DecConnections()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		m.errors.Add(1)
+	}
+
+	result := <-primary
+	m.compared.Add(1)
+	m.latencyDiffSum.Add(int64(duration - result.duration))
+
+	if resp.StatusCode != result.status {
+		m.statusMismatches.Add(1)
+		slog.Debug("shadow response differs",
+			"pool", m.config.Pool,
+			"server", server.Address(),
+			"url", r.URL.String(),
+			"status", resp.StatusCode,
+			"primary_status", result.status,
+		)
+	}
+}
+
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader && code >= http.StatusOK {
+		rec.wroteHeader = true
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,158 @@
+package http_test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+type shadowBackend struct {
+	mu       sync.Mutex
+	bodies   []string
+	shadowed []string
+	status   int
+}
+
+func (b *shadowBackend) received() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.bodies...)
+}
+
+func newShadowBackend(t *testing.T, status int) (*shadowBackend, *services.ServerInfo) {
+	b := &shadowBackend{status: status}
+	return b, newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b.mu.Lock()
+		b.bodies = append(b.bodies, string(body))
+		b.shadowed = append(b.shadowed, r.Header.Get("X-Shadow-Request"))
+		b.mu.Unlock()
+
+		w.WriteHeader(b.status)
+		_, _ = io.WriteString(w, "shadow")
+	})
+}
+
+func newMirroringHandler(t *testing.T, config myhttp.MirrorConfig) (http.Handler, *myhttp.Mirror) {
+	mirror, err := myhttp.NewMirror(config)
+	require.NoError(t, err)
+
+	srvConfig := defaultConfig
+	srvConfig.Routes = []myhttp.Route{{Path: "/", Mirror: mirror}}
+
+	primary := newEchoBackend(t)
+	srv, err := myhttp.NewServer(srvConfig, balancers.NewRoundRobinBalancer([]*services.ServerInfo{primary}))
+	require.NoError(t, err)
+	return srv.Handler, mirror
+}
+
+func TestMirror_CopiesRequests(t *testing.T) {
+	shadow, server := newShadowBackend(t, http.StatusOK)
+	handler, mirror := newMirroringHandler(t, myhttp.MirrorConfig{
+		Route:    "/",
+		Pool:     "canary",
+		Balancer: balancers.NewRoundRobinBalancer([]*services.ServerInfo{server}),
+		Percent:  100,
+	})
+
+	rec := post(handler, "/orders", "payload", 7)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "payload", rec.Body.String())
+
+	require.Eventually(t, func() bool { return mirror.Stats().Mirrored == 1 && len(shadow.received()) == 1 },
+		time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"payload"}, shadow.received())
+	assert.Equal(t, []string{"1"}, shadow.shadowed)
+
+	require.Eventually(t, func() bool { return mirror.Stats().Errors == 0 && mirror.Stats().StatusMismatches == 0 },
+		time.Second, 10*time.Millisecond)
+}
+
+func TestMirror_SkipsLargeBodies(t *testing.T) {
+	shadow, server := newShadowBackend(t, http.StatusOK)
+	handler, mirror := newMirroringHandler(t, myhttp.MirrorConfig{
+		Balancer:     balancers.NewRoundRobinBalancer([]*services.ServerInfo{server}),
+		Percent:      100,
+		MaxBodyBytes: 4,
+	})
+
+	body := strings.Repeat("x", 10)
+	assert.Equal(t, body, post(handler, "/", body, 10).Body.String())
+	assert.Equal(t, body, post(handler, "/", body, -1).Body.String())
+
+	assert.Equal(t, int64(2), mirror.Stats().Skipped)
+	assert.Empty(t, shadow.received())
+}
+
+func TestMirror_RouteBodyLimit(t *testing.T) {
+	shadow, server := newShadowBackend(t, http.StatusOK)
+	handler, mirror := newMirroringHandler(t, myhttp.MirrorConfig{
+		Balancer:          balancers.NewRoundRobinBalancer([]*services.ServerInfo{server}),
+		Percent:           100,
+		RouteMaxBodyBytes: 4,
+	})
+
+	body := strings.Repeat("x", 10)
+	assert.Equal(t, body, post(handler, "/", body, -1).Body.String())
+	assert.Equal(t, int64(1), mirror.Stats().Skipped)
+	assert.Empty(t, shadow.received())
+}
+
+func TestMirror_ResponseHeaderTimeout(t *testing.T) {
+	slow := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	})
+
+	handler, mirror := newMirroringHandler(t, myhttp.MirrorConfig{
+		Balancer:              balancers.NewRoundRobinBalancer([]*services.ServerInfo{slow}),
+		Percent:               100,
+		ResponseHeaderTimeout: 50 * time.Millisecond,
+	})
+
+	get(handler, "/")
+	require.Eventually(t, func() bool { return mirror.Stats().Errors == 1 }, 300*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestMirror_RecordsShadowErrors(t *testing.T) {
+	_, server := newShadowBackend(t, http.StatusInternalServerError)
+	handler, mirror := newMirroringHandler(t, myhttp.MirrorConfig{
+		Route:    "/",
+		Pool:     "canary",
+		Balancer: balancers.NewRoundRobinBalancer([]*services.ServerInfo{server}),
+		Percent:  100,
+	})
+
+	rec := get(handler, "/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	require.Eventually(t, func() bool { return mirror.Stats().StatusMismatches == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), mirror.Stats().Errors)
+
+	admin, err := myhttp.NewAdminServer(myhttp.AdminConfig{Port: 9091, Mirrors: []*myhttp.Mirror{mirror}})
+	require.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	admin.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mirrors", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats []myhttp.MirrorStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Len(t, stats, 1)
+	assert.Equal(t, "canary", stats[0].Pool)
+	assert.Equal(t, int64(1), stats[0].Errors)
+}
+
+func TestMirror_InvalidPercent(t *testing.T) {
+	_, err := myhttp.NewMirror(myhttp.MirrorConfig{Balancer: balancers.NewRoundRobinBalancer(nil), Percent: 150})
+	assert.Error(t, err)
+}
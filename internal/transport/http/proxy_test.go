@@ -0,0 +1,88 @@
+package http_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"test-task/internal/services"
+	"test-task/internal/services/servicestest"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+)
+
+func newProxyHandler(t testing.TB, routes []myhttp.Route, servers ...*services.ServerInfo) http.Handler {
+	config := defaultConfig
+	config.Routes = routes
+	return newHandler(t, config, servers...)
+}
+
+func TestProxy_BasePath(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+	}))
+	t.Cleanup(backend.Close)
+
+	tests := []struct {
+		base, path, want string
+	}{
+		{"", "/users?id=1", "/users?id=1"},
+		{"/api", "/users?id=1", "/api/users?id=1"},
+		{"/api/", "/users?id=1", "/api/users?id=1"},
+		{"/api", "/", "/api/?"},
+		{"/api", "/files/a%2Fb", "/api/files/a%2Fb?"},
+	}
+
+	for _, tt := range tests {
+		handler := newProxyHandler(t, nil, servicestest.HealthyServer(backend.URL+tt.base, "/health"))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, tt.want, rec.Body.String(), tt.base+tt.path)
+	}
+}
+
+func TestProxy_InvalidAddress(t *testing.T) {
+	handler := newProxyHandler(t, nil, servicestest.HealthyServer("http://a:99999", "/health"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func BenchmarkProxyHandler(b *testing.B) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	}))
+	b.Cleanup(backend.Close)
+
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	b.Cleanup(func() { slog.SetDefault(logger) })
+
+	server := servicestest.HealthyServer(backend.URL+"/api", "/health")
+	routes := map[string]myhttp.Route{
+		"plain": {Path: "/"},
+		"header rules": {
+			Path:           "/",
+			RequestHeaders: myhttp.HeaderRules{Set: map[string]string{"X-Real-Ip": "{client_ip}"}},
+		},
+	}
+
+	for name, route := range routes {
+		b.Run(name, func(b *testing.B) {
+			handler := newProxyHandler(b, []myhttp.Route{route}, server)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?id=1", nil))
+				if rec.Code != http.StatusOK {
+					b.Fatalf("unexpected status %d", rec.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Route applies per-path settings. Path is an http.ServeMux pattern, so
+// "/api/" matches the whole subtree and "/health" only the exact path.
+type Route struct {
+	Path            string `validate:"required,startswith=/"`
+	Coalesce        bool
+	RequestHeaders  HeaderRules // applied to requests sent to backends
+	ResponseHeaders HeaderRules // applied to responses sent to clients
+	// MaxBodyBytes limits the request body, zero means no limit.
+	MaxBodyBytes int64 `validate:"gte=0"`
+	// UpstreamTimeout limits the whole exchange with the backend, including
+	// the response body, zero means no limit.
+	UpstreamTimeout time.Duration `validate:"gte=0"`
+	Access          Access
+	Mirror          *Mirror // optional, requests are not mirrored when nil
+	// Split, when set, chooses the pool for the route's requests instead of
+	// the server's balancer and sticky sessions.
+	Split *Split
+}
+
+func withDefaultRoute(routes []Route, hidden []string) []Route {
+	if slices.Contains(hidden, "/") {
+		return routes
+	}
+	for _, route := range routes {
+		if route.Path == "/" {
+			return routes
+		}
+	}
+	return append(routes, Route{Path: "/"})
+}
+
+func routeHandler(route Route, config Config, transport *http.Transport, nextServer serverSelector) (http.Handler, error) {
+
+	if route.Split != nil {
+		nextServer = route.Split.NextServer
+	}
+
+	handler := proxyHandler(route, transport, nextServer)
+	if route.Mirror != nil {
+		handler = route.Mirror.Middleware(handler)
+	}
+	if route.Coalesce {
+		handler = newCoalescer().Middleware(handler)
+	}
+	if config.Cache != nil {
+		handler = config.Cache.Middleware(config.Name, handler)
+	}
+	if route.Split != nil {
+		handler = route.Split.Middleware(handler)
+	}
+	if !route.RequestHeaders.empty() || !route.ResponseHeaders.empty() {
+		handler = headerRulesMiddleware(route, handler)
+	}
+	if config.Compression.Enabled {
+		handler = newCompressor(config.Compression).Middleware(handler)
+	}
+
+	if !route.Access.empty() {
+		access, err := newAccessControl(route.Access, mustParseCIDRs(config.TrustedProxies))
+		if err != nil {
+			return nil, err
+		}
+		handler = access.Middleware(handler)
+	}
+
+	return recoverMiddleware(handler), nil
+}
@@ -1,13 +1,14 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"runtime/debug"
 	"strconv"
 	"test-task/internal/services"
@@ -15,16 +16,51 @@ import (
 )
 
 type Config struct {
-	Port                int           `validate:"required,min=1,max=65535"`
+	// Name identifies the listener, the responses it caches are not served
+	// by other listeners sharing the Cache.
+	Name string
+	Port int `validate:"required_without=Address,omitempty,min=1,max=65535"`
+	// Address overrides Port, e.g. "127.0.0.1:8080".
+	Address             string        `validate:"omitempty,hostname_port"`
 	DialTimeout         time.Duration `validate:"required,gt=0"`
 	KeepAlive           time.Duration `validate:"required,gt=0"`
 	MaxIdleConns        int           `validate:"required,gt=0"`
 	MaxIdleConnsPerHost int           `validate:"required,gt=0"`
 	IdleConnTimeout     time.Duration `validate:"required,gt=0"`
+	// Client side limits. Zero timeouts are disabled, zero MaxHeaderBytes
+	// means the net/http default of 1MB.
+	ReadHeaderTimeout time.Duration `validate:"gte=0"`
+	ReadTimeout       time.Duration `validate:"gte=0"`
+	WriteTimeout      time.Duration `validate:"gte=0"`
+	IdleTimeout       time.Duration `validate:"gte=0"`
+	MaxHeaderBytes    int           `validate:"gte=0"`
+	// ResponseHeaderTimeout limits the wait for a backend's response headers
+	// after the request is sent, zero means no limit.
+	ResponseHeaderTimeout time.Duration `validate:"gte=0"`
+	// TrustedProxies are the peers whose X-Forwarded-For is believed when
+	// checking route access.
+	TrustedProxies []string `validate:"dive,cidr"`
+	StickySessions StickySessions
+	Cache          *Cache  // optional, responses are not cached when nil
+	Routes         []Route `validate:"unique=Path,dive"`
+	// HiddenPaths are answered with 404, so requests for routes served by
+	// other listeners don't fall through to "/" without the route's access
+	// rules.
+	HiddenPaths []string `validate:"unique,dive,startswith=/"`
+	Compression Compression
+	TLS         TLS
+}
+
+// TLS makes the server HTTPS when the files are set. The server only holds
+// the certificate, the listener has to be wrapped with its TLSConfig.
+type TLS struct {
+	CertFile string `validate:"required_with=KeyFile,omitempty,file"`
+	KeyFile  string `validate:"required_with=CertFile,omitempty,file"`
 }
 
 type Balancer interface {
 	NextServer() (*services.ServerInfo, error)
+	Servers() []*services.ServerInfo
 }
 
 type loggingResponseWriter struct {
@@ -37,6 +73,25 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+// newTransport builds the backend transport from the dial, keep-alive, idle
+// connection and response header settings of config.
+func newTransport(config Config) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   config.DialTimeout,
+			KeepAlive: config.KeepAlive,
+		}).DialContext,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+	}
+}
+
 func NewServer(config Config, balancer Balancer) (*http.Server, error) {
 
 	validate := validator.New()
@@ -46,29 +101,96 @@ func NewServer(config Config, balancer Balancer) (*http.Server, error) {
 
 	mux := http.NewServeMux()
 
-	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   config.DialTimeout,
-			KeepAlive: config.KeepAlive,
-		}).DialContext,
-		MaxIdleConns:        config.MaxIdleConns,
-		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
-		IdleConnTimeout:     config.IdleConnTimeout,
+	transport := newTransport(config)
+
+	var nextServer serverSelector = func(w http.ResponseWriter, r *http.Request) (*services.ServerInfo, error) {
+		return balancer.NextServer()
+	}
+	if config.StickySessions.Enabled {
+		nextServer = newStickySessions(config.StickySessions, balancer).NextServer
 	}
 
-	mux.Handle("/", recoverMiddleware(proxyHandler(transport, balancer)))
+	for _, path := range config.HiddenPaths {
+		mux.Handle(path, http.NotFoundHandler())
+	}
+	for _, route := range withDefaultRoute(config.Routes, config.HiddenPaths) {
+		handler, err := routeHandler(route, config, transport, nextServer)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		mux.Handle(route.Path, handler)
+	}
 
 	server := &http.Server{
-		Addr:    ":" + strconv.Itoa(config.Port),
-		Handler: mux,
+		Addr:              config.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+	if server.Addr == "" {
+		server.Addr = ":" + strconv.Itoa(config.Port)
+	}
+
+	if config.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			NextProtos:   []string{"h2", "http/1.1"},
+		}
 	}
 	return server, nil
 }
 
-func proxyHandler(transport *http.Transport, balancer Balancer) http.Handler {
+type serverSelector func(w http.ResponseWriter, r *http.Request) (*services.ServerInfo, error)
+
+// routeProxy builds the reverse proxies of a route, one per server. They are
+// built on the first request and kept by the server, so the header variables
+// of a request reach them through the request context.
+type routeProxy struct {
+	route     Route
+	transport *http.Transport
+}
+
+func (p *routeProxy) NewHandler(server *services.ServerInfo) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(server.URL())
+	proxy.Transport = p.transport
+
+	if rules := p.route.RequestHeaders; !rules.empty() {
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			director(req)
+			rules.apply(req.Header, requestVars(req))
+		}
+	}
+
+	proxy.ErrorHandler = proxyErrorHandler(server, p.route.MaxBodyBytes)
+	return proxy
+}
+
+func proxyHandler(route Route, transport *http.Transport, nextServer serverSelector) http.Handler {
+	routeProxy := &routeProxy{route: route, transport: transport}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		server, err := balancer.NextServer()
+		if route.MaxBodyBytes > 0 && r.ContentLength > route.MaxBodyBytes {
+			rejectLargeBody(w, r, route.MaxBodyBytes)
+			return
+		}
+		limitBody(w, r, route.MaxBodyBytes)
+
+		if route.UpstreamTimeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), route.UpstreamTimeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
+		server, err := nextServer(w, r)
 		if err != nil {
 			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
 			slog.Error("couldn't get server", "error", err)
@@ -78,33 +200,31 @@ func proxyHandler(transport *http.Transport, balancer Balancer) http.Handler {
 		server.IncConnections()
 		defer server.DecConnections()
 
-		targetURL, err := url.Parse(server.Address())
-		if err != nil {
+		if server.URL() == nil {
 			http.Error(w, "Bad upstream", http.StatusBadGateway)
-			slog.Error("bad upstream", "url", targetURL)
+			slog.Error("bad upstream", "address", server.Address())
 			return
 		}
 
-		proxy := httputil.NewSingleHostReverseProxy(targetURL)
-		proxy.Transport = transport
-
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			slog.Error("proxy error", "server", server.Address(), "error", err)
-			server.SetHealthy(false)
-			http.Error(w, "Upstream server failure", http.StatusBadGateway)
+		proxy := server.Handler(routeProxy)
+		if vars := requestVars(r); vars != nil {
+			vars.backend = server.Address()
 		}
 
 		start := time.Now()
 		responseWriter := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		proxy.ServeHTTP(responseWriter, r)
+		duration := time.Since(start)
+		server.ObserveRequest(duration, responseWriter.statusCode >= http.StatusInternalServerError)
 
 		slog.Info("HTTP request",
 			"address", server.Address(),
+			"client", r.RemoteAddr,
 			"method", r.Method,
 			"url", r.URL.String(),
 			"status", responseWriter.statusCode,
-			"duration", time.Since(start),
+			"duration", duration,
 		)
 	})
 }
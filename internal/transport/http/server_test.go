@@ -0,0 +1,97 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+func writeCertificate(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestNewServer_Address(t *testing.T) {
+	config := defaultConfig
+	config.Port = 0
+	config.Address = "127.0.0.1:9000"
+	srv, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:9000", srv.Addr)
+
+	config.Address = ""
+	_, err = myhttp.NewServer(config, balancers.NewRoundRobinBalancer(nil))
+	assert.Error(t, err)
+}
+
+func TestNewServer_TLS(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+	config := defaultConfig
+	config.TLS = myhttp.TLS{CertFile: certFile, KeyFile: keyFile}
+
+	srv, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer([]*services.ServerInfo{newBackend(t, "a")}))
+	require.NoError(t, err)
+	require.NotNil(t, srv.TLSConfig)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(tls.NewListener(ln, srv.TLSConfig)) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "a", string(body))
+	assert.Equal(t, 2, resp.ProtoMajor)
+}
+
+func TestNewServer_TLSNeedsBothFiles(t *testing.T) {
+	certFile, _ := writeCertificate(t)
+	config := defaultConfig
+	config.TLS = myhttp.TLS{CertFile: certFile}
+
+	_, err := myhttp.NewServer(config, balancers.NewRoundRobinBalancer(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,288 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"test-task/internal/services"
+)
+
+type SplitBackend struct {
+	Pool     string   `validate:"required"`
+	Balancer Balancer `validate:"required"`
+	Weight   int      `validate:"gte=0"`
+}
+
+type SplitConfig struct {
+	Route    string
+	Backends []SplitBackend `validate:"required,min=1,unique=Pool,dive"`
+	// Header and Cookie name a pool to force, e.g. "X-Canary: canary". A
+	// request without the cookie gets it set to the picked pool and the
+	// version of the weights, so a client stays on one pool until the weights
+	// change and is then picked again. Pools with weight 0 can't be forced,
+	// so setting a weight to 0 rolls every client back.
+	Header string
+	Cookie string
+}
+
+// Split sends a route's requests to several pools in proportion to their
+// weights. The weights can be changed at runtime.
+type Split struct {
+	config   SplitConfig
+	mu       sync.RWMutex
+	weights  []int
+	version  int
+	requests []atomic.Int64
+}
+
+// splitPick is the pool chosen for a request before the cache and the
+// coalescer see it, so they keep the responses of each pool apart.
+type splitPick struct {
+	index   int
+	pool    string
+	forced  bool
+	version int
+	served  int
+}
+
+type splitPickKey struct{}
+
+type SplitStats struct {
+	Route    string           `json:"route"`
+	Weights  map[string]int   `json:"weights"`
+	Requests map[string]int64 `json:"requests"`
+}
+
+func NewSplit(config SplitConfig) (*Split, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	weights := make(map[string]int, len(config.Backends))
+	for _, b := range config.Backends {
+		weights[b.Pool] = b.Weight
+	}
+
+	s := &Split{
+		config:   config,
+		weights:  make([]int, len(config.Backends)),
+		requests: make([]atomic.Int64, len(config.Backends)),
+	}
+	if err := s.SetWeights(weights); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetWeights replaces the weights of the listed pools, pools not listed keep
+// their weight.
+func (s *Split) SetWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := append([]int(nil), s.weights...)
+	for pool, weight := range weights {
+		i := s.index(pool)
+		if i < 0 {
+			return fmt.Errorf("unknown pool %q", pool)
+		}
+		if weight < 0 {
+			return fmt.Errorf("negative weight for pool %q", pool)
+		}
+		updated[i] = weight
+	}
+
+	total := 0
+	for _, w := range updated {
+		total += w
+	}
+	if total == 0 {
+		return errors.New("at least one pool must have a positive weight")
+	}
+
+	s.weights = updated
+	s.version++
+	return nil
+}
+
+func (s *Split) Stats() SplitStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := SplitStats{
+		Route:    s.config.Route,
+		Weights:  make(map[string]int, len(s.weights)),
+		Requests: make(map[string]int64, len(s.weights)),
+	}
+	for i, b := range s.config.Backends {
+		stats.Weights[b.Pool] = s.weights[i]
+		stats.Requests[b.Pool] = s.requests[i].Load()
+	}
+	return stats
+}
+
+// Middleware picks the pool of a request, NextServer then asks that pool.
+func (s *Split) Middleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pick := s.choose(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), splitPickKey{}, pick)))
+	})
+}
+
+func (s *Split) choose(r *http.Request) *splitPick {
+	pick := &splitPick{}
+	pick.index, pick.forced = s.forced(r)
+	if !pick.forced {
+		pick.index, pick.version = s.pick()
+	}
+	pick.pool = s.config.Backends[pick.index].Pool
+	pick.served = pick.index
+	return pick
+}
+
+func (s *Split) NextServer(w http.ResponseWriter, r *http.Request) (*services.ServerInfo, error) {
+
+	pick, ok := r.Context().Value(splitPickKey{}).(*splitPick)
+	if !ok {
+		pick = s.choose(r)
+	}
+
+	served, server, err := s.nextServer(pick.index)
+	if err != nil {
+		return nil, err
+	}
+	pick.served = served
+	s.requests[served].Add(1)
+
+	// a client isn't pinned to the pool it fell back to
+	if !pick.forced && served == pick.index && s.config.Cookie != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     s.config.Cookie,
+			Value:    pick.pool + ":" + strconv.Itoa(pick.version),
+			Path:     "/",
+			HttpOnly: true,
+		})
+	}
+	return server, nil
+}
+
+// splitPool is the pool picked for r, empty outside split routes.
+func splitPool(r *http.Request) string {
+	if pick, ok := r.Context().Value(splitPickKey{}).(*splitPick); ok {
+		return pick.pool
+	}
+	return ""
+}
+
+// splitFellBack reports whether r was served by another pool than the
+// picked one.
+func splitFellBack(r *http.Request) bool {
+	pick, ok := r.Context().Value(splitPickKey{}).(*splitPick)
+	return ok && pick.served != pick.index
+}
+
+// nextServer asks pool i and, when it has nothing healthy, the other pools.
+// It returns the index of the pool that gave the server.
+func (s *Split) nextServer(i int) (int, *services.ServerInfo, error) {
+	server, err := s.config.Backends[i].Balancer.NextServer()
+	if err == nil {
+		return i, server, nil
+	}
+
+	for j, b := range s.config.Backends {
+		if j == i {
+			continue
+		}
+		if server, err := b.Balancer.NextServer(); err == nil {
+			slog.Warn("split pool unavailable", "route", s.config.Route, "pool", s.config.Backends[i].Pool, "fallback", b.Pool)
+			return j, server, nil
+		}
+	}
+	return i, nil, err
+}
+
+func (s *Split) forced(r *http.Request) (int, bool) {
+	if s.config.Header != "" {
+		if i := s.index(r.Header.Get(s.config.Header)); s.enabled(i) {
+			return i, true
+		}
+	}
+	if s.config.Cookie != "" {
+		if c, err := r.Cookie(s.config.Cookie); err == nil {
+			if i := s.cookiePool(c.Value); s.enabled(i) {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// cookiePool returns the pool of a cookie value: a pool name set by hand, or
+// a pool pinned by NextServer while the weights haven't changed since.
+func (s *Split) cookiePool(value string) int {
+	sep := strings.LastIndex(value, ":")
+	if sep < 0 {
+		return s.index(value)
+	}
+	version, err := strconv.Atoi(value[sep+1:])
+	if err != nil {
+		return s.index(value)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if version != s.version {
+		return -1
+	}
+	return s.index(value[:sep])
+}
+
+// enabled reports whether pool i exists and has a positive weight.
+func (s *Split) enabled(i int) bool {
+	if i < 0 {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.weights[i] > 0
+}
+
+// pick returns a pool chosen by weight and the version of the weights.
+func (s *Split) pick() (int, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total := 0
+	for _, w := range s.weights {
+		total += w
+	}
+
+	n := rand.IntN(total)
+	for i, w := range s.weights {
+		if n < w {
+			return i, s.version
+		}
+		n -= w
+	}
+	return len(s.weights) - 1, s.version
+}
+
+func (s *Split) index(pool string) int {
+	for i, b := range s.config.Backends {
+		if b.Pool == pool {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,154 @@
+package http_test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+)
+
+func newSplit(t *testing.T, stableWeight, canaryWeight int, stable, canary *services.ServerInfo) *myhttp.Split {
+	split, err := myhttp.NewSplit(myhttp.SplitConfig{
+		Route: "/",
+		Backends: []myhttp.SplitBackend{
+			{Pool: "default", Balancer: balancers.NewRoundRobinBalancer([]*services.ServerInfo{stable}), Weight: stableWeight},
+			{Pool: "canary", Balancer: balancers.NewRoundRobinBalancer([]*services.ServerInfo{canary}), Weight: canaryWeight},
+		},
+		Header: "X-Canary",
+		Cookie: "release",
+	})
+	require.NoError(t, err)
+	return split
+}
+
+func newSplitHandler(t *testing.T, split *myhttp.Split) http.Handler {
+	config := defaultConfig
+	config.Routes = []myhttp.Route{{Path: "/", Split: split}}
+
+	return newHandler(t, config)
+}
+
+func TestSplit_Weights(t *testing.T) {
+	split := newSplit(t, 80, 20, newBackend(t, "stable"), newBackend(t, "canary"))
+	handler := newSplitHandler(t, split)
+
+	counts := make(map[string]int)
+	for range 1000 {
+		body, _ := serve(t, handler)
+		counts[body]++
+	}
+
+	assert.InDelta(t, 800, counts["stable"], 80)
+	assert.InDelta(t, 200, counts["canary"], 80)
+	assert.Equal(t, int64(counts["canary"]), split.Stats().Requests["canary"])
+}
+
+func TestSplit_Overrides(t *testing.T) {
+	split := newSplit(t, 100, 0, newBackend(t, "stable"), newBackend(t, "canary"))
+	handler := newSplitHandler(t, split)
+
+	body, rec := serve(t, handler)
+	assert.Equal(t, "stable", body)
+	assert.Equal(t, "release=default:1", strings.SplitN(rec.Header().Get("Set-Cookie"), ";", 2)[0])
+
+	// unknown pool names are ignored
+	assert.Equal(t, "stable", get(handler, "/", "X-Canary", "beta").Body.String())
+
+	require.NoError(t, split.SetWeights(map[string]int{"canary": 1}))
+	assert.Equal(t, "canary", get(handler, "/", "X-Canary", "canary").Body.String())
+
+	body, rec = serve(t, handler, &http.Cookie{Name: "release", Value: "canary"})
+	assert.Equal(t, "canary", body)
+	assert.Empty(t, rec.Header().Get("Set-Cookie"))
+}
+
+func TestSplit_Rollback(t *testing.T) {
+	split := newSplit(t, 0, 100, newBackend(t, "stable"), newBackend(t, "canary"))
+	handler := newSplitHandler(t, split)
+
+	body, rec := serve(t, handler)
+	require.Equal(t, "canary", body)
+	cookie := rec.Result().Cookies()[0]
+	assert.Equal(t, "canary:1", cookie.Value)
+
+	// a pinned client moves back once the canary's weight drops to 0
+	require.NoError(t, split.SetWeights(map[string]int{"default": 100, "canary": 0}))
+	body, rec = serve(t, handler, cookie)
+	assert.Equal(t, "stable", body)
+	assert.Equal(t, "release=default:2", strings.SplitN(rec.Header().Get("Set-Cookie"), ";", 2)[0])
+	assert.Equal(t, "stable", get(handler, "/", "X-Canary", "canary").Body.String())
+}
+
+func TestSplit_FallsBackWhenPoolIsDown(t *testing.T) {
+	canary := newBackend(t, "canary")
+	canary.SetHealthy(false)
+	split := newSplit(t, 0, 100, newBackend(t, "stable"), canary)
+	handler := newSplitHandler(t, split)
+
+	body, rec := serve(t, handler)
+	assert.Equal(t, "stable", body)
+	// the client isn't pinned to the fallback pool
+	assert.Empty(t, rec.Header().Get("Set-Cookie"))
+	assert.Equal(t, int64(1), split.Stats().Requests["default"])
+}
+
+func TestSplit_WeightChangeMovesPinnedClients(t *testing.T) {
+	split := newSplit(t, 90, 10, newBackend(t, "stable"), newBackend(t, "canary"))
+	handler := newSplitHandler(t, split)
+
+	cookies := make([]*http.Cookie, 1000)
+	for i := range cookies {
+		_, rec := serve(t, handler)
+		cookies[i] = rec.Result().Cookies()[0]
+	}
+
+	// pinned clients stay while the weights don't change
+	body, rec := serve(t, handler, cookies[0])
+	assert.Equal(t, strings.SplitN(cookies[0].Value, ":", 2)[0] == "canary", body == "canary")
+	assert.Empty(t, rec.Header().Get("Set-Cookie"))
+
+	require.NoError(t, split.SetWeights(map[string]int{"default": 50, "canary": 50}))
+	counts := make(map[string]int)
+	for _, c := range cookies {
+		body, rec := serve(t, handler, c)
+		counts[body]++
+		assert.NotEmpty(t, rec.Header().Get("Set-Cookie"))
+	}
+	assert.InDelta(t, 500, counts["canary"], 80)
+}
+
+func TestSplit_AdminAdjustsWeights(t *testing.T) {
+	split := newSplit(t, 100, 0, newBackend(t, "stable"), newBackend(t, "canary"))
+	handler := newSplitHandler(t, split)
+
+	admin, err := myhttp.NewAdminServer(myhttp.AdminConfig{Port: 9091, Splits: []*myhttp.Split{split}})
+	require.NoError(t, err)
+
+	put := func(route, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		admin.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/splits?route="+route, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := put("/", `{"default": 0, "canary": 100}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, _ := serve(t, handler)
+	assert.Equal(t, "canary", body)
+
+	assert.Equal(t, http.StatusBadRequest, put("/", `{"beta": 10}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put("/", `{"canary": 0}`).Code)
+	assert.Equal(t, http.StatusNotFound, put("/api/", `{"canary": 10}`).Code)
+
+	rec = httptest.NewRecorder()
+	admin.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/splits", nil))
+	var stats []myhttp.SplitStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Len(t, stats, 1)
+	assert.Equal(t, map[string]int{"default": 0, "canary": 100}, stats[0].Weights)
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"test-task/internal/services"
+	"time"
+)
+
+// statusInterval is how often the dashboard stream sends fresh stats.
+const statusInterval = time.Second
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+type AdminPool struct {
+	Name     string   `validate:"required"`
+	Balancer Balancer `validate:"required"`
+}
+
+type PoolStatus struct {
+	Name          string                 `json:"name"`
+	Panic         bool                   `json:"panic"`
+	PanicRequests int64                  `json:"panic_requests"`
+	Servers       []services.ServerStats `json:"servers"`
+}
+
+type Status struct {
+	Pools   []PoolStatus  `json:"pools"`
+	Mirrors []MirrorStats `json:"mirrors,omitempty"`
+	Splits  []SplitStats  `json:"splits,omitempty"`
+}
+
+type panicReporter interface {
+	InPanic() bool
+	PanicRequests() int64
+}
+
+func collectStatus(config AdminConfig) Status {
+	status := Status{
+		Pools:   make([]PoolStatus, len(config.Pools)),
+		Mirrors: mirrorStats(config.Mirrors),
+		Splits:  splitStats(config.Splits),
+	}
+	for i, pool := range config.Pools {
+		servers := pool.Balancer.Servers()
+		status.Pools[i] = PoolStatus{Name: pool.Name, Servers: make([]services.ServerStats, len(servers))}
+		for j, server := range servers {
+			status.Pools[i].Servers[j] = server.Stats()
+		}
+		if p, ok := pool.Balancer.(panicReporter); ok {
+			status.Pools[i].Panic = p.InPanic()
+			status.Pools[i].PanicRequests = p.PanicRequests()
+		}
+	}
+	return status
+}
+
+func statusHandler(config AdminConfig) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, collectStatus(config))
+	})
+}
+
+// statusEventsHandler streams the status as Server-Sent Events until the
+// client goes away or the admin server shuts down.
+func statusEventsHandler(config AdminConfig, shutdown <-chan struct{}) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		ticker := time.NewTicker(statusInterval)
+		defer ticker.Stop()
+
+		for {
+			data, err := json.Marshal(collectStatus(config))
+			if err != nil {
+				slog.Error("failed to encode status", "error", err)
+				return
+			}
+			if _, err := w.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-shutdown:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func dashboardHandler() http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(dashboardPage)
+	})
+}
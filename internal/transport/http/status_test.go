@@ -0,0 +1,122 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+func newStatusAdmin(t *testing.T) (*http.Server, http.Handler, *services.ServerInfo) {
+	backend := newEchoBackend(t)
+	down := services.NewServerInfo("http://127.0.0.1:1", "/health")
+	balancer := balancers.NewRoundRobinBalancer([]*services.ServerInfo{backend, down})
+
+	srv, err := myhttp.NewServer(defaultConfig, balancer)
+	require.NoError(t, err)
+
+	admin, err := myhttp.NewAdminServer(myhttp.AdminConfig{
+		Port:  9091,
+		Pools: []myhttp.AdminPool{{Name: "default", Balancer: balancer}},
+	})
+	require.NoError(t, err)
+	return admin, srv.Handler, backend
+}
+
+func TestStatus_JSON(t *testing.T) {
+	admin, handler, backend := newStatusAdmin(t)
+	for range 3 {
+		require.Equal(t, http.StatusOK, get(handler, "/").Code)
+	}
+
+	rec := get(admin.Handler, "/status")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status myhttp.Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	require.Len(t, status.Pools, 1)
+	pool := status.Pools[0]
+	assert.Equal(t, "default", pool.Name)
+	require.Len(t, pool.Servers, 2)
+
+	assert.Equal(t, backend.Address(), pool.Servers[0].Address)
+	assert.True(t, pool.Servers[0].Healthy)
+	assert.Equal(t, 3, pool.Servers[0].Requests)
+	assert.Zero(t, pool.Servers[0].ErrorRate)
+	assert.Positive(t, pool.Servers[0].P99Ms)
+	assert.False(t, pool.Servers[1].Healthy)
+	assert.Zero(t, pool.Servers[1].Requests)
+}
+
+func TestStatus_PanicRequests(t *testing.T) {
+	down := services.NewServerInfo("http://127.0.0.1:1", "/health")
+	balancer := balancers.NewPanicBalancer(balancers.NewRoundRobinBalancer([]*services.ServerInfo{down}), 0.5)
+	admin, err := myhttp.NewAdminServer(myhttp.AdminConfig{
+		Port:  9091,
+		Pools: []myhttp.AdminPool{{Name: "default", Balancer: balancer}},
+	})
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err := balancer.NextServer()
+		require.NoError(t, err)
+	}
+
+	var status myhttp.Status
+	require.NoError(t, json.NewDecoder(get(admin.Handler, "/status").Body).Decode(&status))
+	require.Len(t, status.Pools, 1)
+	assert.True(t, status.Pools[0].Panic)
+	assert.Equal(t, int64(2), status.Pools[0].PanicRequests)
+}
+
+func TestStatus_Dashboard(t *testing.T) {
+	admin, _, _ := newStatusAdmin(t)
+
+	rec := get(admin.Handler, "/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rec.Body.String(), `new EventSource("status/events")`)
+
+	assert.Equal(t, http.StatusNotFound, get(admin.Handler, "/other").Code)
+}
+
+func TestStatus_Events(t *testing.T) {
+	admin, _, backend := newStatusAdmin(t)
+	ts := httptest.NewUnstartedServer(admin.Handler)
+	ts.Config = admin
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/status/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(resp.Body)
+	var events int
+	for events < 2 && lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var status myhttp.Status
+		require.NoError(t, json.Unmarshal([]byte(data), &status))
+		assert.Equal(t, backend.Address(), status.Pools[0].Servers[0].Address)
+		events++
+	}
+	assert.Equal(t, 2, events)
+
+	// shutdown ends the stream instead of waiting for the client
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, admin.Shutdown(ctx))
+}
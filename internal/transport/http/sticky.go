@@ -0,0 +1,124 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"test-task/internal/services"
+	"time"
+)
+
+type StickySessions struct {
+	Enabled    bool
+	CookieName string `validate:"required_if=Enabled true"`
+	TTL        time.Duration
+	Path       string
+	SameSite   http.SameSite
+	Secure     bool
+	// Secret signs the cookie with HMAC-SHA256 when set, so that clients
+	// can't pick a backend themselves.
+	Secret string
+}
+
+// stickySessions pins a client to a backend with an affinity cookie and falls
+// back to the balancer when the cookie is missing, invalid or points to a
+// server that is no longer healthy.
+type stickySessions struct {
+	config   StickySessions
+	balancer Balancer
+}
+
+func newStickySessions(config StickySessions, balancer Balancer) *stickySessions {
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	return &stickySessions{config: config, balancer: balancer}
+}
+
+func (s *stickySessions) NextServer(w http.ResponseWriter, r *http.Request) (*services.ServerInfo, error) {
+
+	if cookie, err := r.Cookie(s.config.CookieName); err == nil {
+		if server := s.lookup(cookie.Value); server != nil {
+			return server, nil
+		}
+	}
+
+	server, err := s.balancer.NextServer()
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, s.cookie(server))
+	return server, nil
+}
+
+func (s *stickySessions) lookup(value string) *services.ServerInfo {
+
+	id, ok := s.verify(value)
+	if !ok {
+		slog.Debug("invalid affinity cookie", "value", value)
+		return nil
+	}
+
+	for _, server := range s.balancer.Servers() {
+		if serverID(server) != id {
+			continue
+		}
+		if !server.IsHealthy() {
+			slog.Info("sticky server is unhealthy, choosing another one", "address", server.Address())
+			return nil
+		}
+		return server
+	}
+	return nil
+}
+
+func (s *stickySessions) cookie(server *services.ServerInfo) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     s.config.CookieName,
+		Value:    s.sign(serverID(server)),
+		Path:     s.config.Path,
+		Secure:   s.config.Secure,
+		HttpOnly: true,
+		SameSite: s.config.SameSite,
+	}
+	if s.config.TTL > 0 {
+		cookie.MaxAge = int(s.config.TTL.Seconds())
+	}
+	return cookie
+}
+
+func (s *stickySessions) sign(id string) string {
+	if s.config.Secret == "" {
+		return id
+	}
+	return id + "." + s.signature(id)
+}
+
+func (s *stickySessions) verify(value string) (string, bool) {
+	if s.config.Secret == "" {
+		return value, value != ""
+	}
+
+	id, signature, found := strings.Cut(value, ".")
+	if !found {
+		return "", false
+	}
+	return id, hmac.Equal([]byte(signature), []byte(s.signature(id)))
+}
+
+func (s *stickySessions) signature(id string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// serverID identifies a server in cookies without exposing its address.
+func serverID(server *services.ServerInfo) string {
+	sum := sha256.Sum256([]byte(server.Address()))
+	return hex.EncodeToString(sum[:8])
+}
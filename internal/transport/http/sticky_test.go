@@ -0,0 +1,90 @@
+package http_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"test-task/internal/services"
+	myhttp "test-task/internal/transport/http"
+	"testing"
+	"time"
+)
+
+func affinityCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "affinity" {
+			return c
+		}
+	}
+	t.Fatal("affinity cookie was not set")
+	return nil
+}
+
+func newStickyHandler(t *testing.T, secret string, servers ...*services.ServerInfo) http.Handler {
+	config := defaultConfig
+	config.StickySessions = myhttp.StickySessions{
+		Enabled:    true,
+		CookieName: "affinity",
+		TTL:        time.Hour,
+		SameSite:   http.SameSiteStrictMode,
+		Secret:     secret,
+	}
+
+	return newHandler(t, config, servers...)
+}
+
+func TestStickySessions_PinsClientToServer(t *testing.T) {
+	handler := newStickyHandler(t, "", newBackend(t, "a"), newBackend(t, "b"))
+
+	body, rec := serve(t, handler)
+	assert.Equal(t, "a", body)
+
+	cookie := affinityCookie(t, rec)
+	assert.Equal(t, 3600, cookie.MaxAge)
+	assert.Equal(t, "/", cookie.Path)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.True(t, cookie.HttpOnly)
+
+	for i := 0; i < 3; i++ {
+		body, rec = serve(t, handler, cookie)
+		assert.Equal(t, "a", body)
+		assert.Empty(t, rec.Result().Cookies())
+	}
+
+	body, _ = serve(t, handler)
+	assert.Equal(t, "b", body)
+}
+
+func TestStickySessions_UnhealthyServerFallsBack(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	handler := newStickyHandler(t, "", a, b)
+
+	_, rec := serve(t, handler)
+	cookie := affinityCookie(t, rec)
+
+	a.SetHealthy(false)
+
+	body, rec := serve(t, handler, cookie)
+	assert.Equal(t, "b", body)
+
+	newCookie := affinityCookie(t, rec)
+	assert.NotEqual(t, cookie.Value, newCookie.Value)
+}
+
+func TestStickySessions_SignedCookie(t *testing.T) {
+	handler := newStickyHandler(t, "secret", newBackend(t, "a"), newBackend(t, "b"))
+
+	_, rec := serve(t, handler)
+	cookie := affinityCookie(t, rec)
+	assert.Contains(t, cookie.Value, ".")
+
+	body, _ := serve(t, handler, cookie)
+	assert.Equal(t, "a", body)
+
+	tampered := *cookie
+	tampered.Value = cookie.Value[:len(cookie.Value)-2] + "xx"
+
+	body, rec = serve(t, handler, &tampered)
+	assert.Equal(t, "b", body)
+	affinityCookie(t, rec)
+}
@@ -0,0 +1,205 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	v1Prefix    = "PROXY "
+	v1MaxLength = 107
+
+	v2HeaderLength = 16
+	v2Version      = 0x20
+	v2CmdLocal     = 0x00
+	v2CmdProxy     = 0x01
+	v2FamilyInet   = 0x10
+	v2FamilyInet6  = 0x20
+	v2Stream       = 0x01
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var ErrNoHeader = errors.New("missing PROXY protocol header")
+
+// header describes the original connection endpoints. A nil source means the
+// sender did not provide addresses (v1 UNKNOWN or v2 LOCAL) and the connection
+// addresses should be used as is.
+type header struct {
+	source      net.Addr
+	destination net.Addr
+}
+
+func readHeader(r *bufio.Reader) (*header, error) {
+
+	prefix, err := r.Peek(len(v1Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	if string(prefix) == v1Prefix {
+		return readV1(r)
+	}
+
+	if prefix[0] == v2Signature[0] {
+		signature, err := r.Peek(len(v2Signature))
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(signature, v2Signature) {
+			return readV2(r)
+		}
+	}
+
+	return nil, ErrNoHeader
+}
+
+func readV1(r *bufio.Reader) (*header, error) {
+
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 header: %w", err)
+	}
+	if len(line) > v1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("invalid v1 header: malformed line")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &header{}, nil
+	}
+	if len(fields) != 6 {
+		return nil, errors.New("invalid v1 header: wrong number of fields")
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if srcIP == nil || dstIP == nil {
+		return nil, errors.New("invalid v1 header: bad address")
+	}
+	switch fields[1] {
+	case "TCP4":
+		if srcIP.To4() == nil || dstIP.To4() == nil {
+			return nil, errors.New("invalid v1 header: address is not IPv4")
+		}
+	case "TCP6":
+	default:
+		return nil, fmt.Errorf("invalid v1 header: unsupported protocol %q", fields[1])
+	}
+
+	srcPort, err := parsePort(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dstPort, err := parsePort(fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	return &header{
+		source:      &net.TCPAddr{IP: srcIP, Port: srcPort},
+		destination: &net.TCPAddr{IP: dstIP, Port: dstPort},
+	}, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid v1 header: bad port %q", s)
+	}
+	return int(port), nil
+}
+
+func readV2(r *bufio.Reader) (*header, error) {
+
+	buf := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("invalid v2 header: %w", err)
+	}
+
+	verCmd, family := buf[12], buf[13]
+	length := int(binary.BigEndian.Uint16(buf[14:16]))
+
+	if verCmd&0xF0 != v2Version {
+		return nil, fmt.Errorf("invalid v2 header: unsupported version %d", verCmd>>4)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("invalid v2 header: %w", err)
+	}
+
+	switch verCmd & 0x0F {
+	case v2CmdLocal:
+		return &header{}, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("invalid v2 header: unsupported command %d", verCmd&0x0F)
+	}
+
+	var ipLength int
+	switch family & 0xF0 {
+	case v2FamilyInet:
+		ipLength = net.IPv4len
+	case v2FamilyInet6:
+		ipLength = net.IPv6len
+	default:
+		// Unix sockets and unspecified families carry nothing we can use as
+		// a client address.
+		return &header{}, nil
+	}
+
+	if len(payload) < 2*ipLength+4 {
+		return nil, errors.New("invalid v2 header: address block too short")
+	}
+
+	srcIP := net.IP(payload[:ipLength])
+	dstIP := net.IP(payload[ipLength : 2*ipLength])
+	ports := payload[2*ipLength:]
+
+	return &header{
+		source:      &net.TCPAddr{IP: srcIP, Port: int(binary.BigEndian.Uint16(ports[0:2]))},
+		destination: &net.TCPAddr{IP: dstIP, Port: int(binary.BigEndian.Uint16(ports[2:4]))},
+	}, nil
+}
+
+// WriteV2Header writes a PROXY protocol v2 header describing a connection
+// from source to destination. Non-TCP addresses are sent as a LOCAL command.
+func WriteV2Header(w io.Writer, source, destination net.Addr) error {
+
+	buf := make([]byte, v2HeaderLength, v2HeaderLength+36)
+	copy(buf, v2Signature)
+
+	src, srcOk := source.(*net.TCPAddr)
+	dst, dstOk := destination.(*net.TCPAddr)
+	if !srcOk || !dstOk {
+		buf[12] = v2Version | v2CmdLocal
+		_, err := w.Write(buf)
+		return err
+	}
+
+	buf[12] = v2Version | v2CmdProxy
+
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		buf[13] = v2FamilyInet | v2Stream
+	} else {
+		buf[13] = v2FamilyInet6 | v2Stream
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+
+	buf = append(buf, srcIP...)
+	buf = append(buf, dstIP...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(src.Port))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(dst.Port))
+	binary.BigEndian.PutUint16(buf[14:16], uint16(len(buf)-v2HeaderLength))
+
+	_, err := w.Write(buf)
+	return err
+}
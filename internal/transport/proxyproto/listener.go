@@ -0,0 +1,143 @@
+package proxyproto
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Listener accepts PROXY protocol v1 and v2 headers from trusted sources.
+// Connections from other addresses are returned untouched.
+type Listener struct {
+	net.Listener
+	trusted       []*net.IPNet
+	headerTimeout time.Duration
+}
+
+func NewListener(ln net.Listener, trusted []*net.IPNet, headerTimeout time.Duration) *Listener {
+	return &Listener{Listener: ln, trusted: trusted, headerTimeout: headerTimeout}
+}
+
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn), headerTimeout: l.headerTimeout}, nil
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range l.trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn reads the PROXY protocol header lazily on the first Read, RemoteAddr
+// or LocalAddr call so that a slow client can't block the accept loop.
+type Conn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once   sync.Once
+	header *header
+	err    error
+
+	// readDeadline is the caller's deadline, it is put back after the
+	// header is read.
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.header == nil || c.header.source == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.header.source
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.header == nil || c.header.destination == nil {
+		return c.Conn.LocalAddr()
+	}
+	return c.header.destination
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+func (c *Conn) readHeader() {
+	c.mu.Lock()
+	deadline := time.Now().Add(c.headerTimeout)
+	if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+		deadline = c.readDeadline
+	}
+	_ = c.Conn.SetReadDeadline(deadline)
+	c.mu.Unlock()
+
+	c.header, c.err = readHeader(c.reader)
+
+	c.mu.Lock()
+	_ = c.Conn.SetReadDeadline(c.readDeadline)
+	c.mu.Unlock()
+
+	if c.err != nil {
+		slog.Error("failed to read PROXY protocol header", "client", c.Conn.RemoteAddr().String(), "error", c.err)
+		_ = c.Conn.Close()
+	}
+}
@@ -0,0 +1,155 @@
+package proxyproto_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"test-task/internal/transport/proxyproto"
+	"testing"
+	"time"
+)
+
+func newListener(t *testing.T, cidrs ...string) *proxyproto.Listener {
+	trusted, err := proxyproto.ParseCIDRs(cidrs)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	return proxyproto.NewListener(ln, trusted, time.Second)
+}
+
+func sendAndAccept(t *testing.T, ln net.Listener, payload []byte) net.Conn {
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	_, err = client.Write(payload)
+	require.NoError(t, err)
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestListener_V1(t *testing.T) {
+	ln := newListener(t, "127.0.0.0/8")
+	conn := sendAndAccept(t, ln, []byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 443\r\nhello"))
+
+	assert.Equal(t, "192.168.1.10:56324", conn.RemoteAddr().String())
+	assert.Equal(t, "10.0.0.1:443", conn.LocalAddr().String())
+
+	buf := make([]byte, 5)
+	_, err := io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestListener_V1Unknown(t *testing.T) {
+	ln := newListener(t, "127.0.0.0/8")
+	conn := sendAndAccept(t, ln, []byte("PROXY UNKNOWN\r\nhello"))
+
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1")
+}
+
+func TestListener_V2(t *testing.T) {
+	var header bytes.Buffer
+	err := proxyproto.WriteV2Header(&header,
+		&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234},
+		&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 80})
+	require.NoError(t, err)
+
+	ln := newListener(t, "127.0.0.0/8")
+	conn := sendAndAccept(t, ln, append(header.Bytes(), []byte("hello")...))
+
+	assert.Equal(t, "[2001:db8::1]:1234", conn.RemoteAddr().String())
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestListener_V2Local(t *testing.T) {
+	var header bytes.Buffer
+	require.NoError(t, proxyproto.WriteV2Header(&header, nil, nil))
+
+	ln := newListener(t, "127.0.0.0/8")
+	conn := sendAndAccept(t, ln, header.Bytes())
+
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1")
+}
+
+func TestListener_UntrustedSourceIsNotParsed(t *testing.T) {
+	ln := newListener(t, "10.0.0.0/8")
+	payload := []byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 443\r\n")
+	conn := sendAndAccept(t, ln, payload)
+
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1")
+
+	buf := make([]byte, len(payload))
+	_, err := io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, payload, buf)
+}
+
+func TestListener_MissingHeaderFromTrustedSource(t *testing.T) {
+	ln := newListener(t, "127.0.0.0/8")
+	conn := sendAndAccept(t, ln, []byte("GET / HTTP/1.1\r\n\r\n"))
+
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, proxyproto.ErrNoHeader)
+}
+
+func TestConn_KeepsReadDeadline(t *testing.T) {
+	ln := newListener(t, "127.0.0.0/8")
+	conn := sendAndAccept(t, ln, []byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 443\r\n"))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	// Unblocks the read if the deadline is lost.
+	stop := time.AfterFunc(2*time.Second, func() { _ = conn.Close() })
+	defer stop.Stop()
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestListener_StalledRequestTimesOut(t *testing.T) {
+	ln := newListener(t, "127.0.0.0/8")
+	srv := &http.Server{
+		Handler:           http.NotFoundHandler(),
+		ReadHeaderTimeout: 100 * time.Millisecond,
+	}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	_, err = client.Write([]byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 443\r\nGET / HTTP/1.1\r\n"))
+	require.NoError(t, err)
+
+	// The server drops the connection instead of waiting for the rest of
+	// the request.
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = io.ReadAll(client)
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		assert.False(t, netErr.Timeout(), "connection was not closed")
+	}
+}
+
+func TestParseCIDRs_Invalid(t *testing.T) {
+	_, err := proxyproto.ParseCIDRs([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
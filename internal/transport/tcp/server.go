@@ -0,0 +1,284 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"test-task/internal/services"
+	"test-task/internal/transport/proxyproto"
+	"time"
+)
+
+var ErrServerClosed = errors.New("tcp: server closed")
+
+type Config struct {
+	Port int `validate:"required_without=Address,omitempty,min=1,max=65535"`
+	// Address overrides Port, e.g. "127.0.0.1:9000".
+	Address        string        `validate:"omitempty,hostname_port"`
+	ConnectTimeout time.Duration `validate:"required,gt=0"`
+	IdleTimeout    time.Duration `validate:"required,gt=0"`
+	// SendProxyProtocol prepends a PROXY protocol v2 header to every
+	// upstream connection so that backends can see the client address.
+	SendProxyProtocol bool
+}
+
+type Balancer interface {
+	NextServer() (*services.ServerInfo, error)
+}
+
+type Server struct {
+	Addr     string
+	config   Config
+	balancer Balancer
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   atomic.Bool
+}
+
+func NewServer(config Config, balancer Balancer) (*Server, error) {
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	addr := config.Address
+	if addr == "" {
+		addr = ":" + strconv.Itoa(config.Port)
+	}
+
+	return &Server{
+		Addr:     addr,
+		config:   config,
+		balancer: balancer,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+func (s *Server) ListenAndServe() error {
+	if s.closed.Load() {
+		return ErrServerClosed
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+func (s *Server) Serve(ln net.Listener) error {
+
+	s.mu.Lock()
+	if s.closed.Load() {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return ErrServerClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	// Accept errors other than a closed listener, e.g. running out of file
+	// descriptors, are retried with a backoff like net/http does.
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.closed.Load() {
+				return ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+			slog.Error("accept failed", "error", err, "retry_in", delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		s.trackConn(conn, true)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.trackConn(conn, false)
+			s.handle(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting new connections and waits for the active ones to
+// finish. Connections still open when ctx expires are closed forcibly.
+func (s *Server) Shutdown(ctx context.Context) error {
+
+	s.closeListener()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.closeConns()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *Server) Close() error {
+	err := s.closeListener()
+	s.closeConns()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) closeListener() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed.Store(true)
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
+func (s *Server) handle(client net.Conn) {
+	defer client.Close()
+
+	server, err := s.balancer.NextServer()
+	if err != nil {
+		slog.Error("couldn't get server", "error", err)
+		return
+	}
+
+	server.IncConnections()
+	defer server.DecConnections()
+
+	dialStart := time.Now()
+	upstream, err := net.DialTimeout("tcp", server.Address(), s.config.ConnectTimeout)
+	// for TCP the latency is the connect time, sessions can last for hours
+	server.ObserveRequest(time.Since(dialStart), err != nil)
+	if err != nil {
+		slog.Error("proxy error", "server", server.Address(), "error", err)
+		server.Eject("connect failed: " + err.Error())
+		return
+	}
+	s.trackConn(upstream, true)
+	defer s.trackConn(upstream, false)
+	defer upstream.Close()
+
+	if s.config.SendProxyProtocol {
+		if err := proxyproto.WriteV2Header(upstream, client.RemoteAddr(), client.LocalAddr()); err != nil {
+			slog.Error("failed to send PROXY protocol header", "server", server.Address(), "error", err)
+			return
+		}
+	}
+
+	start := time.Now()
+	sent, received := s.pipe(client, upstream, server)
+
+	slog.Info("TCP connection",
+		"address", server.Address(),
+		"client", client.RemoteAddr().String(),
+		"sent", sent,
+		"received", received,
+		"duration", time.Since(start),
+	)
+}
+
+// pipe copies data in both directions until either side closes or stays idle
+// longer than the configured timeout. It returns the number of bytes sent to
+// and received from the upstream server.
+func (s *Server) pipe(client, upstream net.Conn, server *services.ServerInfo) (int64, int64) {
+
+	clientConn := &idleConn{Conn: client, timeout: s.config.IdleTimeout}
+	upstreamConn := &idleConn{Conn: upstream, timeout: s.config.IdleTimeout}
+
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		sent, _ = io.Copy(&countingWriter{Writer: upstreamConn, add: server.AddBytesSent}, clientConn)
+		closeWrite(upstream)
+	}()
+
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(&countingWriter{Writer: clientConn, add: server.AddBytesReceived}, upstreamConn)
+		closeWrite(client)
+	}()
+
+	wg.Wait()
+	return sent, received
+}
+
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
+
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
+type countingWriter struct {
+	io.Writer
+	add func(int64)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.add(int64(n))
+	return n, err
+}
@@ -0,0 +1,209 @@
+package tcp_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"syscall"
+	"test-task/internal/services"
+	"test-task/internal/services/balancers"
+	"test-task/internal/services/servicestest"
+	"test-task/internal/transport/proxyproto"
+	"test-task/internal/transport/tcp"
+	"testing"
+	"time"
+)
+
+func newEchoServer(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+func startProxy(t *testing.T, config tcp.Config, servers []*services.ServerInfo) (*tcp.Server, string) {
+	srv, err := tcp.NewServer(config, balancers.NewRoundRobinBalancer(servers))
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(ln)
+
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv, ln.Addr().String()
+}
+
+var defaultConfig = tcp.Config{
+	Port:           9000,
+	ConnectTimeout: time.Second,
+	IdleTimeout:    time.Second,
+}
+
+func TestServer_ProxiesAndCountsBytes(t *testing.T) {
+	backend := newEchoServer(t)
+	defer backend.Close()
+
+	info := servicestest.HealthyServer(backend.Addr().String(), "")
+	_, addr := startProxy(t, defaultConfig, []*services.ServerInfo{info})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	require.NoError(t, conn.Close())
+
+	assert.Eventually(t, func() bool {
+		return info.Connections() == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(5), info.BytesSent())
+	assert.Equal(t, int64(5), info.BytesReceived())
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	backend := newEchoServer(t)
+	defer backend.Close()
+
+	config := defaultConfig
+	config.IdleTimeout = 100 * time.Millisecond
+
+	info := servicestest.HealthyServer(backend.Addr().String(), "")
+	_, addr := startProxy(t, config, []*services.ServerInfo{info})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_UnavailableBackend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	info := servicestest.HealthyServer(address, "")
+	_, addr := startProxy(t, defaultConfig, []*services.ServerInfo{info})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.False(t, info.IsHealthy())
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	backend := newEchoServer(t)
+	defer backend.Close()
+
+	info := servicestest.HealthyServer(backend.Addr().String(), "")
+	srv, addr := startProxy(t, defaultConfig, []*services.ServerInfo{info})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return true
+		}
+		_ = conn.Close()
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_SendsProxyProtocolHeader(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+
+	trusted, err := proxyproto.ParseCIDRs([]string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	backendLn := proxyproto.NewListener(backend, trusted, time.Second)
+
+	config := defaultConfig
+	config.SendProxyProtocol = true
+
+	info := servicestest.HealthyServer(backend.Addr().String(), "")
+	_, addr := startProxy(t, config, []*services.ServerInfo{info})
+
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	conn, err := backendLn.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+}
+
+// flakyListener fails its first Accept like a process out of file descriptors.
+type flakyListener struct {
+	net.Listener
+	failed bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if !l.failed {
+		l.failed = true
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	return l.Listener.Accept()
+}
+
+func TestServer_RetriesAcceptErrors(t *testing.T) {
+	backend := newEchoServer(t)
+	defer backend.Close()
+
+	srv, err := tcp.NewServer(defaultConfig, balancers.NewRoundRobinBalancer(
+		[]*services.ServerInfo{servicestest.HealthyServer(backend.Addr().String(), "")}))
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(&flakyListener{Listener: ln}) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = conn.Write([]byte("hi"))
+	require.NoError(t, err)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(buf))
+
+	require.NoError(t, srv.Close())
+	assert.ErrorIs(t, <-served, tcp.ErrServerClosed)
+}